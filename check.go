@@ -0,0 +1,98 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// runCheck collects from the exporter once and writes a human-readable
+// summary to w. It returns the process exit code, 0 when chrony is up.
+func runCheck(w io.Writer, exporter prometheus.Collector, address string) int {
+	fmt.Fprintf(w, "Checking chrony at %s\n", address)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	families, err := registry.Gather()
+	if err != nil {
+		fmt.Fprintf(w, "FAILED: unable to gather metrics: %s\n", err)
+		return 1
+	}
+
+	up := false
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			var value float64
+			switch {
+			case m.Gauge != nil:
+				value = m.GetGauge().GetValue()
+			case m.Counter != nil:
+				value = m.GetCounter().GetValue()
+			default:
+				continue
+			}
+			if mf.GetName() == "chrony_up" {
+				up = value == 1
+			}
+			fmt.Fprintf(w, "  %s%s %g\n", mf.GetName(), formatLabels(m.GetLabel()), value)
+		}
+	}
+
+	if !up {
+		fmt.Fprintln(w, "FAILED: chrony is down, see the debug log above for details")
+		return 1
+	}
+	fmt.Fprintln(w, "OK: chrony is up")
+	return 0
+}
+
+// runDump collects from the exporter once and writes the metrics to w in the
+// Prometheus text format. It returns the process exit code.
+func runDump(w io.Writer, exporter prometheus.Collector) int {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	families, err := registry.Gather()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to gather metrics: %s\n", err)
+		return 1
+	}
+	enc := expfmt.NewEncoder(w, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, mf := range families {
+		if err := enc.Encode(mf); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to encode metrics: %s\n", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+func formatLabels(labels []*dto.LabelPair) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels))
+	for _, l := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", l.GetName(), l.GetValue()))
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,91 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/facebook/time/ntp/chrony"
+)
+
+const (
+	chronyDefaultCmdPort = 323
+)
+
+// chronyConfig holds the command settings discovered from a chrony.conf.
+type chronyConfig struct {
+	bindCmdAddresses []string
+	cmdPort          int
+}
+
+// readChronyConfig parses the chrony.conf at the given path.
+func readChronyConfig(path string) (chronyConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return chronyConfig{}, err
+	}
+	defer f.Close()
+	return parseChronyConfig(f)
+}
+
+// parseChronyConfig reads the `bindcmdaddress` and `cmdport` directives,
+// all other directives are ignored.
+func parseChronyConfig(r io.Reader) (chronyConfig, error) {
+	conf := chronyConfig{cmdPort: chronyDefaultCmdPort}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch strings.ToLower(fields[0]) {
+		case "bindcmdaddress":
+			conf.bindCmdAddresses = append(conf.bindCmdAddresses, fields[1])
+		case "cmdport":
+			port, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return conf, fmt.Errorf("invalid cmdport %q: %w", fields[1], err)
+			}
+			conf.cmdPort = port
+		}
+	}
+	return conf, scanner.Err()
+}
+
+// address returns the exporter address for the discovered settings. A
+// configured unix socket is preferred, followed by the UDP command port.
+func (c chronyConfig) address() string {
+	for _, a := range c.bindCmdAddresses {
+		if strings.HasPrefix(a, "/") {
+			return "unix://" + a
+		}
+	}
+	if c.cmdPort == 0 {
+		return "unix://" + chrony.ChronySocketPath
+	}
+	host := "::1"
+	for _, a := range c.bindCmdAddresses {
+		if ip := net.ParseIP(a); ip != nil && !ip.IsUnspecified() {
+			host = ip.String()
+			break
+		}
+	}
+	return net.JoinHostPort(host, strconv.Itoa(c.cmdPort))
+}
@@ -0,0 +1,68 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/facebook/time/ntp/chrony"
+)
+
+// errExecUnsupported is returned by the API requests with the exec transport.
+var errExecUnsupported = errors.New("not supported with --chrony.exec")
+
+// Tracking requests the current tracking data from chrony.
+func (e Exporter) Tracking() (chrony.Tracking, error) {
+	if len(e.execCommand) > 0 {
+		return chrony.Tracking{}, errExecUnsupported
+	}
+	conn, err, cleanup := e.dial()
+	defer cleanup()
+	if err != nil {
+		return chrony.Tracking{}, err
+	}
+	client := chrony.Client{Sequence: initialSequence, Connection: conn}
+	packet, err := e.communicate(&client, "tracking", chrony.NewTrackingPacket())
+	if err != nil {
+		return chrony.Tracking{}, err
+	}
+	tracking, ok := packet.(*chrony.ReplyTracking)
+	if !ok {
+		return chrony.Tracking{}, fmt.Errorf("Got wrong 'tracking' response: %q", packet)
+	}
+	return tracking.Tracking, nil
+}
+
+// Sources requests the current source data of all sources from chrony.
+func (e Exporter) Sources() ([]chrony.SourceData, error) {
+	if len(e.execCommand) > 0 {
+		return nil, errExecUnsupported
+	}
+	conn, err, cleanup := e.dial()
+	defer cleanup()
+	if err != nil {
+		return nil, err
+	}
+	client := chrony.Client{Sequence: initialSequence, Connection: conn}
+	sources, err := e.getSourceData(e.logger, &client)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]chrony.SourceData, 0, len(sources))
+	for _, r := range sources {
+		results = append(results, r.SourceData)
+	}
+	return results, nil
+}
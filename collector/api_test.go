@@ -0,0 +1,42 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"testing"
+)
+
+func TestAPISourcesRemovedDuringEnumeration(t *testing.T) {
+	handle := sourcesHandler(newTestSources(3))
+	address := newFakeChrony(t, func(req fakeRequest) []byte {
+		if req.command == fakeReqSourceData && req.index == 2 {
+			return fakeStatus(req, statusNoSuchSource)
+		}
+		return handle(req)
+	})
+	e := newTestExporter(address, ChronyCollectorConfig{CollectSources: true})
+
+	sources, err := e.Sources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 2 {
+		t.Fatalf("got %d sources, want 2", len(sources))
+	}
+	for i, s := range sources {
+		if want := newTestSources(3)[i].IPAddr.IP[3]; s.IPAddr.To4()[3] != want {
+			t.Errorf("source %d: got address %s", i, s.IPAddr)
+		}
+	}
+}
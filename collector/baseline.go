@@ -0,0 +1,63 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sync"
+	"time"
+)
+
+// offsetSample is a tracking offset at the time of the clock update.
+type offsetSample struct {
+	time   time.Time
+	offset float64
+}
+
+// offsetBaseline keeps the tracking offsets of the clock updates within a
+// rolling window. It is shared by concurrent scrapes.
+type offsetBaseline struct {
+	mtx     sync.Mutex
+	window  time.Duration
+	samples []offsetSample
+}
+
+func newOffsetBaseline(window time.Duration) *offsetBaseline {
+	return &offsetBaseline{window: window}
+}
+
+// deviation records the offset of the clock update at t, and returns the
+// offset minus the mean offset over the window. Repeated scrapes of the same
+// update are only recorded once, so the mean is not biased by the scrape
+// interval.
+func (b *offsetBaseline) deviation(t time.Time, offset float64) float64 {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if n := len(b.samples); n == 0 || t.After(b.samples[n-1].time) {
+		b.samples = append(b.samples, offsetSample{time: t, offset: offset})
+	}
+
+	cutoff := b.samples[len(b.samples)-1].time.Add(-b.window)
+	i := 0
+	for i < len(b.samples) && b.samples[i].time.Before(cutoff) {
+		i++
+	}
+	b.samples = b.samples[i:]
+
+	var sum float64
+	for _, s := range b.samples {
+		sum += s.offset
+	}
+	return offset - sum/float64(len(b.samples))
+}
@@ -14,19 +14,30 @@
 package collector
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
+	"math"
 	"net"
 	"os"
 	"path"
+	"path/filepath"
 	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/facebook/time/ntp/chrony"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
@@ -44,64 +55,474 @@ var (
 		prometheus.GaugeValue,
 	}
 
+	collectorUpMetric = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "collector", "up"),
+			"Whether the collector succeeded.",
+			[]string{"collector"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	transportMetric = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "exporter", "transport"),
+			"The transport used to connect to the chrony server.",
+			[]string{"type"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	socketPermissionErrorMetric = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "exporter", "socket_permission_error"),
+			"Whether connecting to the chrony unix socket failed with a permission error.",
+			nil,
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	dialDurationMetric = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "exporter", "dial_duration_seconds"),
+			"Time spent connecting to the chrony server during the scrape in seconds.",
+			nil,
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	dnsDurationMetric = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "exporter", "dns_duration_seconds"),
+			"Total time spent resolving names during the scrape in seconds.",
+			nil,
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	commandDurationMetric = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "exporter", "command_duration_seconds"),
+			"Total time spent in chrony commands during the scrape in seconds.",
+			nil,
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
 	// Globally track scrapes to provide better logging context.
 	scrapeID atomic.Uint64
+
+	// The chrony request sequence starts at a random value per process, so
+	// that a late UDP reply to a request from a previous exporter process is
+	// unlikely to carry the sequence of a new request.
+	initialSequence = randomSequence()
 )
 
+// randomSequence returns a random chrony request sequence, falling back to
+// 1 if the random source fails.
+func randomSequence() uint32 {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 1
+	}
+	return binary.BigEndian.Uint32(b[:])
+}
+
+// Scrapes returns the number of scrapes started by all exporters.
+func Scrapes() uint64 {
+	return scrapeID.Load()
+}
+
 // Exporter collects chrony stats from the given server and exports
 // them using the prometheus metrics package.
 type Exporter struct {
 	address string
+	network string
+	netns   string
 	timeout time.Duration
 
+	ntpdataAddress string
+
+	execCommand []string
+
+	// conn is an inherited connection to chrony shared by all scrapes,
+	// which are serialized by connMtx.
+	conn    net.Conn
+	connMtx *sync.Mutex
+
+	minimal            bool
+	softFail           map[string]bool
 	collectSources     bool
+	collectSourcestats bool
 	collectTracking    bool
 	collectServerstats bool
+	collectRefclock    bool
 	chmodSocket        bool
+	staleSocketAge     time.Duration
 	dnsLookups         bool
+	resolver           *net.Resolver
+	hostLabel          string
+	nameMap            map[string]string
+	nameMaxLength      int
+	dnsCanonicalOnly   bool
+
+	externalNTPServers []string
+	logfilePath        string
+	trackingSamples    int
+
+	sourcesStratumLabel     bool
+	sourcesIncludeAddresses []*net.IPNet
+	sourcesSkipUnknownState bool
+	sourcesAggregateOnly    bool
+	sourcesWithNTPData      bool
+	ntpdataOnlySelected     bool
+	timestampsMilliseconds  bool
+	metricOpts              metricOptions
+
+	sourcesSelectedRefIDLabel  bool
+	sourcesUseConfiguredNames  bool
+	sourcesReachabilityBits    bool
+	sourcesBatch               bool
+	sourcesStateCodes          bool
+	sourcesLastSampleTimestamp bool
+	sourcesOffsetSpreadAll     bool
+	sourcesWorkers             int
+	sourcesStaleThreshold      time.Duration
+
+	commandDuration *prometheus.HistogramVec
+	commandRetries  *prometheus.CounterVec
+	dnsLookupErrors prometheus.Counter
+	offsetBaseline  *offsetBaseline
+	clockSteps      *clockSteps
+	sourceOffsets   *sourceOffsets
+
+	sourcesEnumerationMismatch prometheus.Counter
+	commands                   *commandSupport
+	scrapeGroup                *singleflight.Group
+
+	// timings is set per scrape on the Exporter copy used by Collect.
+	timings *scrapeTimings
+	// ctx is the context of the scrape, set by WithContext. Reverse DNS
+	// lookups are cancelled when it is done.
+	ctx context.Context
+	// selectedSource is the address of the source selected by tracking, set
+	// per scrape on the Exporter copy used by Collect.
+	selectedSource net.IP
+	// worker is the index of a sources worker, set on the Exporter copy
+	// that dials its connection.
+	worker int
 
 	logger *slog.Logger
 }
 
+// scrapeTimings accumulates the time spent in each phase of a scrape.
+type scrapeTimings struct {
+	dial    time.Duration
+	dns     time.Duration
+	command time.Duration
+}
+
 type typedDesc struct {
 	desc      *prometheus.Desc
 	valueType prometheus.ValueType
 }
 
-func (d *typedDesc) mustNewConstMetric(value float64, labels ...string) prometheus.Metric {
-	return prometheus.MustNewConstMetric(d.desc, d.valueType, value, labels...)
+func (d *typedDesc) mustNewConstMetric(opts metricOptions, value float64, labels ...string) prometheus.Metric {
+	if opts.roundDigits > 0 && d.valueType == prometheus.GaugeValue {
+		value = roundSignificant(value, opts.roundDigits)
+	}
+	m := prometheus.MustNewConstMetric(d.desc, d.valueType, value, labels...)
+	if opts.traceLogger != nil {
+		logMetric(opts.traceLogger, m, value)
+	}
+	return m
+}
+
+// metricOptions are the options of an exporter applied to every metric built
+// by typedDesc.mustNewConstMetric.
+type metricOptions struct {
+	// traceLogger logs every metric when set.
+	traceLogger *slog.Logger
+	// roundDigits rounds the gauges to this number of significant digits
+	// when positive.
+	roundDigits int
 }
 
 // ChronyCollectorConfig configures the exporter parameters.
 type ChronyCollectorConfig struct {
 	// Address is the Chrony server UDP command port.
 	Address string
+	// Network is the network used to dial a UDP address, one of `udp`, `udp4` or `udp6`.
+	Network string
+	// NTPDataAddress is a separate address for the `ntpdata` requests, such as
+	// the unix socket when Address is the UDP command port.
+	NTPDataAddress string
+	// Netns is the name or path of a network namespace to dial the Chrony server in (Linux only).
+	Netns string
 	// Timeout configures the socket timeout to the Chrony server.
 	Timeout time.Duration
+	// Exec is the command used to run chronyc, such as `docker exec chrony chronyc`.
+	// When set, tracking and sources are collected by running chronyc
+	// instead of using the command protocol. Experimental.
+	Exec string
+	// Conn is an already connected chrony command socket, such as a file
+	// descriptor inherited from the parent process. When set, it is used
+	// instead of dialing Address, scrapes are serialized on it and it is
+	// never closed.
+	Conn net.Conn
 
 	// ChmodSocket will set the unix datagram socket to mode `0666` when true.
 	ChmodSocket bool
+	// StaleSocketAge is the age after which receiving unix datagram sockets
+	// left behind by other exporter processes are removed. Zero disables removal.
+	StaleSocketAge time.Duration
 	// DNSLookups will reverse resolve IP addresses to names when true.
 	DNSLookups bool
+	// NameMaxLength limits the length of reverse DNS names joined into a
+	// label. Zero means no limit.
+	NameMaxLength int
+	// DNSCanonicalOnly uses a single reverse DNS name, the shortest, instead
+	// of joining all names when true.
+	DNSCanonicalOnly bool
+	// NameMap maps IP addresses to static names, taking precedence over DNS lookups.
+	NameMap map[string]string
+	// ShareScrapes will share a single in-flight collection between concurrent
+	// scrapes when true.
+	ShareScrapes bool
+	// TraceMetrics will log every emitted metric name, labels and value when true.
+	TraceMetrics bool
+	// RoundDigits rounds gauge values to the given number of significant
+	// digits. Zero keeps the full precision.
+	RoundDigits int
+	// HostLabel is the value of a `chrony_host` label added to all metrics.
+	// Empty disables the label.
+	HostLabel string
 
+	// Minimal will only check that chrony responds and export `chrony_up`
+	// when true, all collectors are skipped.
+	Minimal bool
+	// SoftFailCollectors are the collectors whose failures don't set `chrony_up` to 0.
+	SoftFailCollectors []string
 	// CollectSources will configure the exporter to collect `chronyc sources`.
 	CollectSources bool
+	// CollectSourcestats will configure the exporter to collect `chronyc sourcestats`.
+	CollectSourcestats bool
+	// SourcesStratumLabel will add a `stratum` label to the sources state info metric when true.
+	SourcesStratumLabel bool
+	// SourcesIncludeAddresses limits sources metrics to the given networks. All sources are included when empty.
+	SourcesIncludeAddresses []*net.IPNet
+	// SourcesSkipUnknownState will drop sources in a state unknown to the chrony library when true.
+	SourcesSkipUnknownState bool
+	// SourcesAggregateOnly will only export the aggregate sources metrics, without per source series, when true.
+	SourcesAggregateOnly bool
+	// SourcesWithNTPData will request the `ntpdata` of each NTP source when true, only available over the unix socket.
+	SourcesWithNTPData bool
+	// NTPDataOnlySelected will only request the `ntpdata` of the source
+	// selected by tracking when true. All NTP sources are requested when
+	// tracking is disabled or fails.
+	NTPDataOnlySelected bool
+	// SourcesSelectedRefIDLabel will add the refid selected by tracking as a `selected_refid` label to the sources metrics when true.
+	SourcesSelectedRefIDLabel bool
+	// SourcesUseConfiguredNames will use the source names configured in chrony for the sources metrics when true.
+	SourcesUseConfiguredNames bool
+	// SourcesReachabilityBits will export each bit of the sources reachability register when true.
+	SourcesReachabilityBits bool
+	// SourcesBatch will pipeline the `sourcedata` requests instead of waiting
+	// for each reply when true.
+	SourcesBatch bool
+	// SourcesStateCodes will export the sources state as a numeric code when true.
+	SourcesStateCodes bool
+	// SourcesLastSampleTimestamp will export the sources last sample time as a
+	// unix timestamp when true.
+	SourcesLastSampleTimestamp bool
+	// SourcesOffsetWindow is the sliding window of the sources offset summary.
+	// Zero disables the summary.
+	SourcesOffsetWindow time.Duration
+	// SourcesOffsetQuantiles are the quantiles of the sources offset summary.
+	SourcesOffsetQuantiles []float64
+	// SourcesOffsetSpreadAll computes the sources offset spread over all
+	// included sources when true, instead of only the selectable sources.
+	SourcesOffsetSpreadAll bool
+	// SourcesWorkers is the number of connections the sourcedata requests
+	// are spread over. Values below 2 use a single connection. Ignored with
+	// SourcesBatch and Conn.
+	SourcesWorkers int
+	// SourcesStaleThreshold is the last sample age after which a source is
+	// counted as stale. Zero uses twice the polling interval of each source.
+	SourcesStaleThreshold time.Duration
+	// TimestampsMilliseconds will additionally emit timestamps as integer milliseconds when true.
+	TimestampsMilliseconds bool
 	// CollectTracking will configure the exporter to collect `chronyc tracking`.
 	CollectTracking bool
+	// TrackingSamples is the number of tracking samples taken per scrape to
+	// compute the offset jitter. Values below 2 disable the jitter metric.
+	TrackingSamples int
+	// TrackingOffsetBaselineWindow is the window of the rolling mean tracking
+	// offset used for the offset deviation metric. Zero disables the metric.
+	TrackingOffsetBaselineWindow time.Duration
+	// TrackingStepThreshold is the minimum step of the exporter host clock
+	// between scrapes counted as a clock step. Zero disables the metric.
+	TrackingStepThreshold time.Duration
 	// CollectServerstats will configure the exporter to collect `chronyc serverstats`.
 	CollectServerstats bool
+	// CollectRefclock will configure the exporter to collect the reference clock status.
+	CollectRefclock bool
+	// LogfilePath is the chrony logdir. When set, the tracking metrics are
+	// read from its tracking.log instead of the tracking command.
+	LogfilePath string
+	// ExternalNTPServers are queried directly by the exporter to cross-check the local clock offset.
+	ExternalNTPServers []string
 }
 
 func NewExporter(conf ChronyCollectorConfig, logger *slog.Logger) Exporter {
+	nameMap := make(map[string]string, len(conf.NameMap))
+	for address, name := range conf.NameMap {
+		// Normalize the address so that it matches the reply IP format.
+		if ip := net.ParseIP(address); ip != nil {
+			address = ip.String()
+		}
+		nameMap[address] = name
+	}
+
+	network := conf.Network
+	if network == "" {
+		network = "udp"
+	}
+
+	softFail := make(map[string]bool, len(conf.SoftFailCollectors))
+	for _, name := range conf.SoftFailCollectors {
+		softFail[name] = true
+	}
+
+	var offsets *sourceOffsets
+	if conf.SourcesOffsetWindow > 0 {
+		offsets = newSourceOffsets(conf.SourcesOffsetWindow, conf.SourcesOffsetQuantiles)
+	}
+
+	var scrapeGroup *singleflight.Group
+	if conf.ShareScrapes {
+		scrapeGroup = &singleflight.Group{}
+	}
+
+	var baseline *offsetBaseline
+	if conf.TrackingOffsetBaselineWindow > 0 {
+		baseline = newOffsetBaseline(conf.TrackingOffsetBaselineWindow)
+	}
+
+	// The steps are those of the exporter host clock, which is only the clock
+	// of chrony when it is reached over its local unix socket.
+	var steps *clockSteps
+	if conf.TrackingStepThreshold > 0 {
+		if conf.Exec == "" && conf.Conn == nil && strings.HasPrefix(conf.Address, "unix://") {
+			steps = newClockSteps(conf.TrackingStepThreshold)
+		} else {
+			logger.Warn("Clock step detection requires a unix socket address, the steps metric is disabled", "address", conf.Address)
+		}
+	}
+
+	metricOpts := metricOptions{roundDigits: conf.RoundDigits}
+	if conf.TraceMetrics {
+		metricOpts.traceLogger = logger
+	}
+
 	return Exporter{
 		address: conf.Address,
+		network: network,
+		netns:   conf.Netns,
 		timeout: conf.Timeout,
 
+		ntpdataAddress: conf.NTPDataAddress,
+
+		execCommand: strings.Fields(conf.Exec),
+
+		conn:    conf.Conn,
+		connMtx: &sync.Mutex{},
+
+		minimal:            conf.Minimal,
+		softFail:           softFail,
 		collectSources:     conf.CollectSources,
+		collectSourcestats: conf.CollectSourcestats,
 		collectTracking:    conf.CollectTracking,
 		collectServerstats: conf.CollectServerstats,
+		collectRefclock:    conf.CollectRefclock,
 		chmodSocket:        conf.ChmodSocket,
+		staleSocketAge:     conf.StaleSocketAge,
 		dnsLookups:         conf.DNSLookups,
+		resolver:           net.DefaultResolver,
+		hostLabel:          conf.HostLabel,
+		nameMap:            nameMap,
+		nameMaxLength:      conf.NameMaxLength,
+		dnsCanonicalOnly:   conf.DNSCanonicalOnly,
+
+		externalNTPServers: conf.ExternalNTPServers,
+		logfilePath:        conf.LogfilePath,
+		trackingSamples:    conf.TrackingSamples,
+
+		sourcesStratumLabel:     conf.SourcesStratumLabel,
+		sourcesIncludeAddresses: conf.SourcesIncludeAddresses,
+		sourcesSkipUnknownState: conf.SourcesSkipUnknownState,
+		sourcesAggregateOnly:    conf.SourcesAggregateOnly,
+		sourcesWithNTPData:      conf.SourcesWithNTPData,
+		ntpdataOnlySelected:     conf.NTPDataOnlySelected,
+		timestampsMilliseconds:  conf.TimestampsMilliseconds,
+		metricOpts:              metricOpts,
+
+		sourcesSelectedRefIDLabel:  conf.SourcesSelectedRefIDLabel,
+		sourcesUseConfiguredNames:  conf.SourcesUseConfiguredNames,
+		sourcesReachabilityBits:    conf.SourcesReachabilityBits,
+		sourcesBatch:               conf.SourcesBatch,
+		sourcesStateCodes:          conf.SourcesStateCodes,
+		sourcesLastSampleTimestamp: conf.SourcesLastSampleTimestamp,
+		sourcesOffsetSpreadAll:     conf.SourcesOffsetSpreadAll,
+		sourcesWorkers:             conf.SourcesWorkers,
+		sourcesStaleThreshold:      conf.SourcesStaleThreshold,
+
+		commandDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "command_duration_seconds",
+				Help:      "Round-trip duration of chrony commands in seconds.",
+				Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 8),
+			},
+			[]string{"command"},
+		),
+		commandRetries: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "exporter",
+				Name:      "command_retries_total",
+				Help:      "Total number of chrony commands retried on a fresh unix socket after a timeout.",
+			},
+			[]string{"command"},
+		),
+		dnsLookupErrors: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "exporter",
+				Name:      "dns_lookup_errors_total",
+				Help:      "Total number of failed reverse DNS lookups of source addresses.",
+			},
+		),
+		offsetBaseline: baseline,
+		clockSteps:     steps,
+		sourceOffsets:  offsets,
+
+		commands:    newCommandSupport(),
+		scrapeGroup: scrapeGroup,
+		sourcesEnumerationMismatch: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "sources",
+				Name:      "enumeration_mismatch_total",
+				Help:      "Total number of scrapes where chrony returned fewer sources than it reported.",
+			},
+		),
 
 		logger: logger,
 	}
@@ -111,89 +532,511 @@ func NewExporter(conf ChronyCollectorConfig, logger *slog.Logger) Exporter {
 func (e Exporter) Describe(ch chan<- *prometheus.Desc) {
 }
 
-func (e Exporter) dial() (net.Conn, error, func()) {
+// transport returns the transport used to connect to the chrony server.
+func (e Exporter) transport() string {
+	if len(e.execCommand) > 0 {
+		return "exec"
+	}
+	if e.conn != nil {
+		return "fd"
+	}
 	if strings.HasPrefix(e.address, "unix://") {
-		remote := strings.TrimPrefix(e.address, "unix://")
-		base, _ := path.Split(remote)
-		local := path.Join(base, fmt.Sprintf("chrony_exporter.%d.sock", os.Getpid()))
-		conn, err := net.DialUnix("unixgram",
-			&net.UnixAddr{Name: local, Net: "unixgram"},
-			&net.UnixAddr{Name: remote, Net: "unixgram"},
-		)
+		return "unix"
+	}
+	if strings.HasPrefix(e.address, "tcp://") {
+		return "tcp"
+	}
+	return "udp"
+}
+
+func (e Exporter) dial() (conn net.Conn, err error, closer func()) {
+	if e.netns == "" {
+		return e.dialConn()
+	}
+	nsErr := inNetns(e.netns, func() {
+		conn, err, closer = e.dialConn()
+	})
+	if nsErr != nil {
+		return nil, nsErr, func() {}
+	}
+	return conn, err, closer
+}
+
+func (e Exporter) dialConn() (net.Conn, error, func()) {
+	if e.conn != nil {
+		return e.inheritedConn()
+	}
+	if e.transport() == "unix" {
+		return e.dialUnix()
+	}
+
+	if e.transport() == "tcp" {
+		conn, err := net.DialTimeout("tcp", strings.TrimPrefix(e.address, "tcp://"), e.timeout)
 		if err != nil {
-			return nil, err, func() { os.Remove(local) }
-		}
-		if e.chmodSocket {
-			if err := os.Chmod(local, 0666); err != nil {
-				return nil, err, func() { conn.Close(); os.Remove(local) }
-			}
+			return nil, err, func() {}
 		}
-		err = conn.SetReadDeadline(time.Now().Add(e.timeout))
+		err = conn.SetDeadline(time.Now().Add(e.timeout))
 		if err != nil {
-			e.logger.Debug("Couldn't set read-timeout for unix datagram socket", "err", err)
+			e.logger.Debug("Couldn't set timeout for tcp socket", "err", err)
 		}
-		return conn, nil, func() { conn.Close(); os.Remove(local) }
+		return framedConn{conn}, nil, func() { conn.Close() }
 	}
 
-	conn, err := net.DialTimeout("udp", e.address, e.timeout)
+	conn, err := net.DialTimeout(e.network, e.address, e.timeout)
+	if err != nil && e.network != "udp6" {
+		// The default address fails on hosts with IPv6 disabled, where
+		// chronyd only listens on the IPv4 loopback.
+		if host, port, splitErr := net.SplitHostPort(e.address); splitErr == nil && net.ParseIP(host).Equal(net.IPv6loopback) {
+			fallback := net.JoinHostPort("127.0.0.1", port)
+			e.logger.Debug("Couldn't connect to the IPv6 loopback, falling back to IPv4", "address", e.address, "fallback", fallback, "err", err)
+			conn, err = net.DialTimeout("udp4", fallback, e.timeout)
+		}
+	}
 	return conn, err, func() {}
 }
 
+// inheritedConn locks the inherited connection for a scrape. Replies that
+// arrived late to a previous scrape carry the same sequences as the new
+// requests, so they are drained first.
+func (e Exporter) inheritedConn() (net.Conn, error, func()) {
+	e.connMtx.Lock()
+	unlock := func() { e.connMtx.Unlock() }
+	if err := e.conn.SetReadDeadline(time.Now()); err != nil {
+		return nil, err, unlock
+	}
+	buf := make([]byte, 1024)
+	for {
+		if _, err := e.conn.Read(buf); err != nil {
+			break
+		}
+	}
+	if err := e.conn.SetDeadline(time.Now().Add(e.timeout)); err != nil {
+		return nil, err, unlock
+	}
+	return e.conn, nil, unlock
+}
+
+// RemoveStaleSockets removes receiving unix datagram sockets left behind by
+// crashed exporter processes that are older than the configured age.
+func (e Exporter) RemoveStaleSockets() {
+	if e.staleSocketAge <= 0 || !strings.HasPrefix(e.address, "unix://") {
+		return
+	}
+	base, _ := path.Split(strings.TrimPrefix(e.address, "unix://"))
+	matches, err := filepath.Glob(path.Join(base, "chrony_exporter.*.sock"))
+	if err != nil {
+		e.logger.Warn("Couldn't list stale unix datagram sockets", "dir", base, "err", err)
+		return
+	}
+	removed := 0
+	for _, m := range matches {
+		info, err := os.Lstat(m)
+		if err != nil || info.Mode().Type() != fs.ModeSocket || time.Since(info.ModTime()) < e.staleSocketAge {
+			continue
+		}
+		if err := os.Remove(m); err != nil {
+			e.logger.Warn("Couldn't remove stale unix datagram socket", "socket", m, "err", err)
+			continue
+		}
+		removed++
+	}
+	e.logger.Info("Removed stale unix datagram sockets", "dir", base, "count", removed)
+}
+
 // Collect implements prometheus.Collector.
 func (e Exporter) Collect(ch chan<- prometheus.Metric) {
+	if e.scrapeGroup == nil {
+		e.collect(ch)
+		return
+	}
+	// Concurrent scrapes of the same address share a single collection,
+	// which isn't cancelled with the context of the first scrape.
+	if e.ctx != nil {
+		e.ctx = context.WithoutCancel(e.ctx)
+	}
+	metrics, _, shared := e.scrapeGroup.Do(e.address, func() (any, error) {
+		return e.gather(), nil
+	})
+	if shared {
+		e.logger.Debug("Shared in-flight scrape", "address", e.address)
+	}
+	for _, m := range metrics.([]prometheus.Metric) {
+		ch <- m
+	}
+}
+
+// WithContext returns a copy of the exporter that collects with the context
+// of a scrape, such as the context of the scrape request. Reverse DNS lookups
+// are cancelled when ctx is done.
+func (e Exporter) WithContext(ctx context.Context) Exporter {
+	e.ctx = ctx
+	return e
+}
+
+// gather collects all metrics into a slice.
+func (e Exporter) gather() []prometheus.Metric {
+	var metrics []prometheus.Metric
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for m := range ch {
+			metrics = append(metrics, m)
+		}
+	}()
+	e.collect(ch)
+	close(ch)
+	<-done
+	return metrics
+}
+
+func (e Exporter) collect(ch chan<- prometheus.Metric) {
 	logger := e.logger.With("scrape_id", scrapeID.Add(1))
+	e.timings = &scrapeTimings{}
 	start := time.Now()
 	logger.Debug("Scrape starting")
-	var up float64
+	if e.hostLabel != "" {
+		labeled, wait := withLabel(ch, "chrony_host", e.hostLabel)
+		defer wait()
+		ch = labeled
+	}
+	if e.minimal {
+		ch <- upMetric.mustNewConstMetric(e.metricOpts, e.ping(logger))
+		logger.Debug("Scrape completed", "seconds", time.Since(start).Seconds())
+		return
+	}
+
+	var up, permissionError float64
+	// failed is set by the collectors that mark chrony as down.
+	var failed bool
+	collectorUp := make(map[string]float64)
 	defer func() {
 		logger.Debug("Scrape completed", "seconds", time.Since(start).Seconds())
-		ch <- upMetric.mustNewConstMetric(up)
+		if failed {
+			up = 0
+		}
+		ch <- upMetric.mustNewConstMetric(e.metricOpts, up)
+		for name, value := range collectorUp {
+			ch <- collectorUpMetric.mustNewConstMetric(e.metricOpts, value, name)
+		}
+		ch <- transportMetric.mustNewConstMetric(e.metricOpts, 1.0, e.transport())
+		if e.transport() == "unix" {
+			ch <- socketPermissionErrorMetric.mustNewConstMetric(e.metricOpts, permissionError)
+		}
+		e.commandDuration.Collect(ch)
+		e.commandRetries.Collect(ch)
+		ch <- e.dnsLookupErrors
+		e.commands.collect(ch, e.metricOpts)
+		if e.collectSources || e.collectSourcestats {
+			ch <- e.sourcesEnumerationMismatch
+		}
+		ch <- dialDurationMetric.mustNewConstMetric(e.metricOpts, e.timings.dial.Seconds())
+		ch <- dnsDurationMetric.mustNewConstMetric(e.metricOpts, e.timings.dns.Seconds())
+		ch <- commandDurationMetric.mustNewConstMetric(e.metricOpts, e.timings.command.Seconds())
 	}()
+
+	// record sets the collector status. Collectors using a command that
+	// chrony doesn't support are skipped, and soft fail collectors fail,
+	// without marking chrony as down.
+	record := func(name string, err error) {
+		switch {
+		case err == nil:
+			collectorUp[name] = 1
+		case errors.Is(err, errCommandUnsupported):
+			logger.Debug("Skipping collector", "collector", name, "err", err)
+		default:
+			logger.Debug("Couldn't get "+name, "err", err)
+			if !e.softFail[name] {
+				failed = true
+			}
+			collectorUp[name] = 0
+		}
+	}
+
+	e.getExternalMetrics(logger, ch)
+
+	if e.collectTracking && e.logfilePath != "" {
+		record("tracking", e.getTrackingLogMetrics(logger, ch))
+	}
+
+	if len(e.execCommand) > 0 {
+		up = 1
+		e.collectExec(logger, ch, record)
+		return
+	}
+
+	dialStart := time.Now()
 	conn, err, cleanup := e.dial()
+	e.timings.dial = time.Since(dialStart)
 	defer cleanup()
 	if err != nil {
-		logger.Debug("Couldn't connect to chrony", "address", e.address, "err", err)
+		if e.transport() == "unix" && errors.Is(err, fs.ErrPermission) {
+			// The most common cause of a failing unix socket, log it at a
+			// higher level to distinguish it from chronyd not running.
+			logger.Warn("Permission denied connecting to the chrony unix socket, run the exporter as the chrony user or in its group, or set --collector.chmod-socket when running as root", "address", e.address, "err", err)
+			permissionError = 1
+		} else {
+			logger.Debug("Couldn't connect to chrony", "address", e.address, "err", err)
+		}
+		for _, name := range e.commandCollectors() {
+			collectorUp[name] = 0
+		}
 		return
 	}
 
 	up = 1
 
-	client := chrony.Client{Sequence: 1, Connection: conn}
+	client := chrony.Client{Sequence: initialSequence, Connection: conn}
+
+	// Tracking is collected first so that the selected source can be
+	// matched in the sources metrics.
+	var selected trackingSelection
+	if e.collectTracking && e.logfilePath == "" {
+		selected, err = e.getTrackingMetrics(logger, ch, client)
+		record("tracking", err)
+	}
+
+	// The sources and refclock collectors share a single enumeration of the
+	// sources.
+	var sourceData []chrony.ReplySourceData
+	var sourceDataErr error
+	sourceDataTime := time.Now()
+	if e.collectSources || e.collectRefclock {
+		sourceData, sourceDataErr = e.getSourceData(logger, &client)
+	}
 
 	if e.collectSources {
-		err = e.getSourcesMetrics(logger, ch, client)
-		if err != nil {
-			logger.Debug("Couldn't get sources", "err", err)
-			up = 0
+		if sourceDataErr == nil {
+			e.selectedSource = selected.address
+			sourcesCh := ch
+			wait := func() {}
+			if e.sourcesSelectedRefIDLabel {
+				sourcesCh, wait = withLabel(ch, "selected_refid", selected.refID)
+			}
+			e.getSourcesMetrics(logger, sourcesCh, client, sourceDataTime, sourceData)
+			wait()
 		}
+		record("sources", sourceDataErr)
 	}
 
-	if e.collectTracking {
-		err = e.getTrackingMetrics(logger, ch, client)
-		if err != nil {
-			logger.Debug("Couldn't get tracking", "err", err)
-			up = 0
+	if e.collectSourcestats {
+		record("sourcestats", e.getSourcestatsMetrics(logger, ch, client))
+	}
+
+	if e.collectServerstats {
+		record("serverstats", e.getServerstatsMetrics(logger, ch, client))
+	}
+
+	if e.collectRefclock {
+		if sourceDataErr == nil {
+			e.getRefclockMetrics(logger, ch, sourceData)
 		}
+		record("refclock", sourceDataErr)
+	}
+}
+
+// collectExec collects tracking and sources by running chronyc, the other
+// collectors are not supported.
+func (e Exporter) collectExec(logger *slog.Logger, ch chan<- prometheus.Metric, record func(string, error)) {
+	var selected trackingSelection
+	if e.collectTracking && e.logfilePath == "" {
+		var err error
+		selected, err = e.getExecTrackingMetrics(logger, ch)
+		record("tracking", err)
 	}
 
+	if e.collectSources {
+		e.selectedSource = selected.address
+		sourcesCh := ch
+		wait := func() {}
+		if e.sourcesSelectedRefIDLabel {
+			sourcesCh, wait = withLabel(ch, "selected_refid", selected.refID)
+		}
+		err := e.getExecSourcesMetrics(logger, sourcesCh)
+		wait()
+		record("sources", err)
+	}
+}
+
+// ping returns 1 when chrony replies to the smallest command request. A
+// dial alone doesn't detect an unreachable chrony over UDP.
+func (e Exporter) ping(logger *slog.Logger) float64 {
+	if len(e.execCommand) > 0 {
+		if _, err := e.runChronyc("tracking"); err != nil {
+			logger.Debug("Couldn't run chronyc", "err", err)
+			return 0
+		}
+		return 1
+	}
+	conn, err, cleanup := e.dial()
+	defer cleanup()
+	if err != nil {
+		logger.Debug("Couldn't connect to chrony", "address", e.address, "err", err)
+		return 0
+	}
+	client := chrony.Client{Sequence: initialSequence, Connection: conn}
+	if _, err := e.communicate(&client, "sources", chrony.NewSourcesPacket()); err != nil {
+		logger.Debug("Couldn't get sources", "err", err)
+		return 0
+	}
+	return 1
+}
+
+// commandCollectors returns the enabled collectors that use the chrony
+// command protocol.
+func (e Exporter) commandCollectors() []string {
+	var names []string
+	if e.collectSources {
+		names = append(names, "sources")
+	}
+	if e.collectSourcestats {
+		names = append(names, "sourcestats")
+	}
+	if e.collectTracking && e.logfilePath == "" {
+		names = append(names, "tracking")
+	}
 	if e.collectServerstats {
-		err = e.getServerstatsMetrics(logger, ch, client)
-		if err != nil {
-			logger.Debug("Couldn't get serverstats", "err", err)
-			up = 0
+		names = append(names, "serverstats")
+	}
+	if e.collectRefclock {
+		names = append(names, "refclock")
+	}
+	return names
+}
+
+// communicate sends a single command to chrony, recording its round-trip
+// duration under the given command name. Commands that chrony replied to as
+// unsupported are not sent again.
+func (e Exporter) communicate(client *chrony.Client, command string, packet chrony.RequestPacket) (chrony.ResponsePacket, error) {
+	if !e.commands.supported(command) {
+		return nil, fmt.Errorf("%w: %s", errCommandUnsupported, command)
+	}
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start)
+		e.commandDuration.WithLabelValues(command).Observe(duration.Seconds())
+		if e.timings != nil {
+			e.timings.command += duration
+		}
+	}()
+	reply, err := exchange(client, packet)
+	if rc, ok := client.Connection.(*redialConn); ok && isTimeout(err) {
+		if dialErr := rc.reconnect(); dialErr != nil {
+			e.logger.Debug("Couldn't redial the unix socket", "command", command, "err", dialErr)
+		} else {
+			e.logger.Debug("Command timed out, retrying on a fresh unix socket", "command", command, "err", err)
+			e.commandRetries.WithLabelValues(command).Inc()
+			reply, err = exchange(client, packet)
+		}
+	}
+	if err != nil && commandUnsupported(err) {
+		e.commands.set(command, false)
+		return nil, fmt.Errorf("%w: %s: %w", errCommandUnsupported, command, err)
+	}
+	if err == nil {
+		e.commands.set(command, true)
+	}
+	return reply, err
+}
+
+// isTimeout returns true when err is a network timeout.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// labeledMetric adds a label to a collected metric.
+type labeledMetric struct {
+	prometheus.Metric
+	label *dto.LabelPair
+}
+
+func (m labeledMetric) Write(out *dto.Metric) error {
+	if err := m.Metric.Write(out); err != nil {
+		return err
+	}
+	out.Label = append(out.Label, m.label)
+	slices.SortFunc(out.Label, func(a, b *dto.LabelPair) int {
+		return strings.Compare(a.GetName(), b.GetName())
+	})
+	return nil
+}
+
+// withLabel returns a channel that adds the label to each metric sent to it
+// before forwarding it to ch. An empty value is not added. The returned
+// function must be called once all metrics have been sent.
+func withLabel(ch chan<- prometheus.Metric, name, value string) (chan<- prometheus.Metric, func()) {
+	labeled := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	label := &dto.LabelPair{Name: &name, Value: &value}
+	go func() {
+		defer close(done)
+		for m := range labeled {
+			if value != "" {
+				m = labeledMetric{Metric: m, label: label}
+			}
+			ch <- m
 		}
+	}()
+	return labeled, func() {
+		close(labeled)
+		<-done
+	}
+}
+
+// roundSignificant rounds value to the given number of significant digits.
+func roundSignificant(value float64, digits int) float64 {
+	if value == 0 || math.IsInf(value, 0) || math.IsNaN(value) {
+		return value
+	}
+	rounded, err := strconv.ParseFloat(strconv.FormatFloat(value, 'g', digits, 64), 64)
+	if err != nil {
+		return value
+	}
+	return rounded
+}
+
+// logMetric logs the name, labels and value of a metric.
+func logMetric(logger *slog.Logger, m prometheus.Metric, value float64) {
+	var pb dto.Metric
+	if err := m.Write(&pb); err != nil {
+		logger.Debug("Couldn't decode metric", "metric", m.Desc(), "err", err)
+		return
+	}
+	labels := make([]any, 0, len(pb.GetLabel()))
+	for _, l := range pb.GetLabel() {
+		labels = append(labels, slog.String(l.GetName(), l.GetValue()))
 	}
+	logger.Debug("Metric", "name", metricName(m.Desc()), slog.Group("labels", labels...), "value", value)
+}
+
+// metricName extracts the fully-qualified metric name from a descriptor.
+func metricName(d *prometheus.Desc) string {
+	_, name, _ := strings.Cut(d.String(), `fqName: "`)
+	name, _, _ = strings.Cut(name, `"`)
+	return name
 }
 
 func (e Exporter) dnsLookup(logger *slog.Logger, address net.IP) string {
 	start := time.Now()
 	defer func() {
-		logger.Debug("DNS lookup took", "seconds", time.Since(start).Seconds())
+		duration := time.Since(start)
+		logger.Debug("DNS lookup took", "seconds", duration.Seconds())
+		if e.timings != nil {
+			e.timings.dns += duration
+		}
 	}()
+	if name, ok := e.nameMap[address.String()]; ok {
+		return name
+	}
 	if !e.dnsLookups {
 		return address.String()
 	}
-	names, err := net.LookupAddr(address.String())
+	names, err := e.lookupAddr(address)
+	if err != nil {
+		logger.Debug("DNS lookup failed", "address", address.String(), "err", err)
+		e.dnsLookupErrors.Inc()
+	}
 	if err != nil || len(names) < 1 {
 		return address.String()
 	}
@@ -201,5 +1044,45 @@ func (e Exporter) dnsLookup(logger *slog.Logger, address net.IP) string {
 		names[i] = strings.TrimRight(name, ".")
 	}
 	sort.Strings(names)
-	return strings.Join(slices.Compact(names), ",")
+	if e.dnsCanonicalOnly {
+		// The shortest name, the first in sorted order on ties, so that the
+		// label is stable across lookups.
+		return slices.MinFunc(names, func(a, b string) int { return len(a) - len(b) })
+	}
+	return joinNames(slices.Compact(names), e.nameMaxLength)
+}
+
+// lookupAddr reverse resolves the address within the timeout. The lookup is
+// cancelled when the context of the scrape is done.
+func (e Exporter) lookupAddr(address net.IP) ([]string, error) {
+	ctx := e.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+	return e.resolver.LookupAddr(ctx, address.String())
+}
+
+// joinNames joins names with "," without exceeding maxLength, keeping whole
+// names where possible. A first name longer than maxLength is truncated.
+func joinNames(names []string, maxLength int) string {
+	joined := strings.Join(names, ",")
+	if maxLength <= 0 || len(joined) <= maxLength {
+		return joined
+	}
+	if len(names[0]) >= maxLength {
+		return names[0][:maxLength]
+	}
+	joined = names[0]
+	for _, name := range names[1:] {
+		if len(joined)+1+len(name) > maxLength {
+			break
+		}
+		joined += "," + name
+	}
+	return joined
 }
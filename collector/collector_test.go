@@ -0,0 +1,465 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/facebook/time/ntp/chrony"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// The chrony command protocol request commands answered by the fake chrony.
+const (
+	fakeReqSources     uint16 = 14
+	fakeReqSourceData  uint16 = 15
+	fakeReqTracking    uint16 = 33
+	fakeReqSourceStats uint16 = 34
+	fakeReqServerStats uint16 = 54
+)
+
+// fakeRequest is a request received by the fake chrony.
+type fakeRequest struct {
+	command  uint16
+	sequence uint32
+	index    int32
+}
+
+// parseFakeRequest parses the command, sequence and source index of a raw
+// request.
+func parseFakeRequest(b []byte) (fakeRequest, bool) {
+	if len(b) < 24 {
+		return fakeRequest{}, false
+	}
+	return fakeRequest{
+		command:  binary.BigEndian.Uint16(b[4:]),
+		sequence: binary.BigEndian.Uint32(b[8:]),
+		index:    int32(binary.BigEndian.Uint32(b[20:])),
+	}, true
+}
+
+// fakeHandler returns the raw reply to a request, nil drops the request.
+type fakeHandler func(req fakeRequest) []byte
+
+// serveFakeChrony replies to the requests received on conn until it is
+// closed. With a latency, each reply is sent after the latency without
+// delaying the following requests, like a reply crossing a network.
+func serveFakeChrony(conn net.PacketConn, handle fakeHandler, latency time.Duration) {
+	buf := make([]byte, 1024)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req, ok := parseFakeRequest(buf[:n])
+		if !ok {
+			continue
+		}
+		reply := handle(req)
+		switch {
+		case reply == nil:
+		case latency > 0:
+			time.AfterFunc(latency, func() { conn.WriteTo(reply, addr) })
+		default:
+			conn.WriteTo(reply, addr)
+		}
+	}
+}
+
+// newFakeChrony starts a fake chrony on a local UDP socket and returns its
+// address.
+func newFakeChrony(tb testing.TB, handle fakeHandler) string {
+	return newSlowFakeChrony(tb, 0, handle)
+}
+
+// newSlowFakeChrony starts a fake chrony that replies after the latency.
+func newSlowFakeChrony(tb testing.TB, latency time.Duration, handle fakeHandler) string {
+	tb.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { conn.Close() })
+	go serveFakeChrony(conn, handle, latency)
+	return conn.LocalAddr().String()
+}
+
+// fakeReply encodes a reply to the request.
+func fakeReply(req fakeRequest, reply chrony.ReplyType, status chrony.ResponseStatusType, content any) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, chrony.ReplyHead{
+		Version:  6,
+		PKTType:  2,
+		Command:  chrony.CommandType(req.command),
+		Reply:    reply,
+		Status:   status,
+		Sequence: req.sequence,
+	})
+	if content != nil {
+		binary.Write(&buf, binary.BigEndian, content)
+	}
+	return buf.Bytes()
+}
+
+// fakeStatus encodes a reply to the request with an unsuccessful status.
+func fakeStatus(req fakeRequest, status chrony.ResponseStatusType) []byte {
+	return fakeReply(req, 1, status, nil)
+}
+
+type fakeIPAddr struct {
+	IP     [16]byte
+	Family uint16
+	Pad    uint16
+}
+
+func newFakeIPAddr(address string) fakeIPAddr {
+	var a fakeIPAddr
+	ip := net.ParseIP(address)
+	switch {
+	case ip == nil:
+	case ip.To4() != nil:
+		copy(a.IP[:], ip.To4())
+		a.Family = 1
+	default:
+		copy(a.IP[:], ip)
+		a.Family = 2
+	}
+	return a
+}
+
+type fakeSourceData struct {
+	IPAddr         fakeIPAddr
+	Poll           int16
+	Stratum        uint16
+	State          chrony.SourceStateType
+	Mode           chrony.ModeType
+	Flags          uint16
+	Reachability   uint16
+	SinceSample    uint32
+	OrigLatestMeas int32
+	LatestMeas     int32
+	LatestMeasErr  int32
+}
+
+type fakeTracking struct {
+	RefID              uint32
+	IPAddr             fakeIPAddr
+	Stratum            uint16
+	LeapStatus         uint16
+	RefTimeSecHigh     uint32
+	RefTimeSecLow      uint32
+	RefTimeNsec        uint32
+	CurrentCorrection  int32
+	LastOffset         int32
+	RMSOffset          int32
+	FreqPPM            int32
+	ResidFreqPPM       int32
+	SkewPPM            int32
+	RootDelay          int32
+	RootDispersion     int32
+	LastUpdateInterval int32
+}
+
+type fakeSourceStats struct {
+	RefID              uint32
+	IPAddr             fakeIPAddr
+	NSamples           uint32
+	NRuns              uint32
+	SpanSeconds        uint32
+	StandardDeviation  int32
+	ResidFreqPPM       int32
+	SkewPPM            int32
+	EstimatedOffset    int32
+	EstimatedOffsetErr int32
+}
+
+// toChronyFloat encodes x in the chrony float format, a 7 bit exponent and
+// a 25 bit coefficient, translated from UTI_FloatHostToNetwork in chrony.
+func toChronyFloat(x float64) int32 {
+	const (
+		expBits  = 7
+		coefBits = 32 - expBits
+		expMin   = -(1 << (expBits - 1))
+		expMax   = -expMin - 1
+		coefMax  = 1<<(coefBits-1) - 1
+	)
+	var exp, coef, neg int32
+	if x < 0 {
+		x = -x
+		neg = 1
+	}
+	switch {
+	case x < 1e-100:
+		exp, coef = 0, 0
+	case x > 1e100:
+		exp, coef = expMax, coefMax+neg
+	default:
+		exp = int32(math.Log(x)/math.Log(2)) + 1
+		coef = int32(x*math.Pow(2, float64(-exp+coefBits)) + 0.5)
+		for coef > coefMax+neg {
+			coef >>= 1
+			exp++
+		}
+		if exp > expMax {
+			exp, coef = expMax, coefMax+neg
+		} else if exp < expMin {
+			if exp+coefBits >= expMin {
+				coef >>= expMin - exp
+				exp = expMin
+			} else {
+				exp, coef = 0, 0
+			}
+		}
+	}
+	if neg == 1 {
+		coef = int32(uint32(-coef) << expBits >> expBits)
+	}
+	return int32(uint32(exp)<<coefBits | uint32(coef))
+}
+
+// sourcesHandler replies to the sources and sourcedata requests with the
+// sources, and to other requests as invalid.
+func sourcesHandler(sources []fakeSourceData) fakeHandler {
+	return func(req fakeRequest) []byte {
+		switch req.command {
+		case fakeReqSources:
+			return fakeReply(req, chrony.RpyNSources, statusSuccess, uint32(len(sources)))
+		case fakeReqSourceData:
+			if req.index < 0 || int(req.index) >= len(sources) {
+				return fakeStatus(req, statusNoSuchSource)
+			}
+			return fakeReply(req, chrony.RpySourceData, statusSuccess, sources[req.index])
+		}
+		return fakeStatus(req, statusInvalid)
+	}
+}
+
+// newTestSources returns n synchronised NTP sources.
+func newTestSources(n int) []fakeSourceData {
+	sources := make([]fakeSourceData, n)
+	for i := range sources {
+		sources[i] = fakeSourceData{
+			IPAddr:       newFakeIPAddr(net.IPv4(192, 0, 2, byte(i+1)).String()),
+			Poll:         6,
+			Stratum:      2,
+			State:        chrony.SourceStateCandidate,
+			Mode:         chrony.SourceModeClient,
+			Reachability: 0377,
+			LatestMeas:   toChronyFloat(0.5),
+		}
+	}
+	return sources
+}
+
+// newTestExporter returns an exporter for the fake chrony at address.
+func newTestExporter(address string, conf ChronyCollectorConfig) Exporter {
+	conf.Address = address
+	if conf.Timeout == 0 {
+		conf.Timeout = time.Second
+	}
+	return NewExporter(conf, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// gatherMetrics collects the metrics of a single scrape.
+func gatherMetrics(t *testing.T, c prometheus.Collector) []*dto.MetricFamily {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return families
+}
+
+// metricValue returns the value of the metric with the name and label pairs.
+func metricValue(families []*dto.MetricFamily, name string, labels ...string) (float64, bool) {
+	for _, mf := range families {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			if !hasLabels(m, labels) {
+				continue
+			}
+			switch {
+			case m.Gauge != nil:
+				return m.GetGauge().GetValue(), true
+			case m.Counter != nil:
+				return m.GetCounter().GetValue(), true
+			case m.Untyped != nil:
+				return m.GetUntyped().GetValue(), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// metricCount returns the number of series of the metric.
+func metricCount(families []*dto.MetricFamily, name string) int {
+	for _, mf := range families {
+		if mf.GetName() == name {
+			return len(mf.GetMetric())
+		}
+	}
+	return 0
+}
+
+func hasLabels(m *dto.Metric, labels []string) bool {
+	for i := 0; i+1 < len(labels); i += 2 {
+		found := false
+		for _, l := range m.GetLabel() {
+			if l.GetName() == labels[i] && l.GetValue() == labels[i+1] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// expectMetric fails the test when the metric is missing or has another
+// value.
+func expectMetric(t *testing.T, families []*dto.MetricFamily, want float64, name string, labels ...string) {
+	t.Helper()
+	got, ok := metricValue(families, name, labels...)
+	if !ok {
+		t.Errorf("%s%v: missing", name, labels)
+		return
+	}
+	if got != want {
+		t.Errorf("%s%v: got %g, want %g", name, labels, got, want)
+	}
+}
+
+func TestToChronyFloat(t *testing.T) {
+	for _, x := range []float64{0, 1, -1, 0.5, -0.25, 0.001, -123.456, 1e-9} {
+		got := chronyFloatValue(toChronyFloat(x))
+		if math.Abs(got-x) > math.Abs(x)*1e-6 {
+			t.Errorf("toChronyFloat(%g) decodes as %g", x, got)
+		}
+	}
+}
+
+// chronyFloatValue decodes a chrony float through the chrony client.
+func chronyFloatValue(f int32) float64 {
+	req := fakeRequest{command: fakeReqSourceData, sequence: 1}
+	reply := fakeReply(req, chrony.RpySourceData, statusSuccess, fakeSourceData{LatestMeas: f})
+	packet, err := decodeReply(chrony.NewSourceDataPacket(0), reply)
+	if err != nil {
+		return math.NaN()
+	}
+	return packet.(*chrony.ReplySourceData).LatestMeas
+}
+
+func TestUp(t *testing.T) {
+	address := newFakeChrony(t, sourcesHandler(newTestSources(2)))
+	e := newTestExporter(address, ChronyCollectorConfig{CollectSources: true, CollectServerstats: true, SoftFailCollectors: []string{"serverstats"}})
+	families := gatherMetrics(t, e)
+
+	expectMetric(t, families, 1, "chrony_up")
+	expectMetric(t, families, 1, "chrony_collector_up", "collector", "sources")
+	// serverstats is answered as invalid, so it is skipped as unsupported.
+	if _, ok := metricValue(families, "chrony_collector_up", "collector", "serverstats"); ok {
+		t.Error("chrony_collector_up{collector=\"serverstats\"}: want unsupported collector skipped")
+	}
+	if n := metricCount(families, "chrony_up"); n != 1 {
+		t.Errorf("chrony_up: got %d series, want 1", n)
+	}
+}
+
+func TestUpDown(t *testing.T) {
+	address := newFakeChrony(t, func(req fakeRequest) []byte { return fakeStatus(req, 1) })
+	e := newTestExporter(address, ChronyCollectorConfig{CollectSources: true})
+	families := gatherMetrics(t, e)
+
+	expectMetric(t, families, 0, "chrony_up")
+	expectMetric(t, families, 0, "chrony_collector_up", "collector", "sources")
+}
+
+func TestDNSLookupCancelled(t *testing.T) {
+	address := newFakeChrony(t, sourcesHandler(newTestSources(3)))
+	e := newTestExporter(address, ChronyCollectorConfig{CollectSources: true, DNSLookups: true, Timeout: time.Minute})
+	// A resolver that doesn't answer until the lookup is cancelled.
+	e.resolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	families := gatherMetrics(t, e.WithContext(ctx))
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("scrape took %s after the scrape was cancelled", elapsed)
+	}
+
+	// The sources are exported with their address as the name.
+	expectMetric(t, families, 1, "chrony_collector_up", "collector", "sources")
+	expectMetric(t, families, 2, "chrony_sources_stratum", "source_address", "192.0.2.1", "source_name", "192.0.2.1")
+	if got, _ := metricValue(families, "chrony_exporter_dns_lookup_errors_total"); got != 3 {
+		t.Errorf("chrony_exporter_dns_lookup_errors_total: got %g, want 3", got)
+	}
+}
+
+func TestTraceMetricsPerExporter(t *testing.T) {
+	address := newFakeChrony(t, sourcesHandler(newTestSources(1)))
+	var traced, other bytes.Buffer
+	newLogger := func(w io.Writer) *slog.Logger {
+		return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+	e := NewExporter(ChronyCollectorConfig{Address: address, Timeout: time.Second, CollectSources: true, TraceMetrics: true}, newLogger(&traced).With("target", "main"))
+	// An exporter built later, such as for a probe target, doesn't change
+	// the tracing of the first one.
+	NewExporter(ChronyCollectorConfig{Address: address, Timeout: time.Second}, newLogger(&other).With("target", "other"))
+	gatherMetrics(t, e)
+
+	if !bytes.Contains(traced.Bytes(), []byte("msg=Metric target=main name=chrony_sources_stratum")) {
+		t.Errorf("traced log is missing chrony_sources_stratum:\n%s", traced.String())
+	}
+	if bytes.Contains(traced.Bytes(), []byte("target=other")) {
+		t.Error("traced log has the attributes of another exporter")
+	}
+	if other.Len() != 0 {
+		t.Errorf("other exporter logged:\n%s", other.String())
+	}
+}
+
+func TestRoundDigitsPerExporter(t *testing.T) {
+	tracking := newTestTracking()
+	tracking.RootDelay = toChronyFloat(0.0123456)
+	address := newFakeChrony(t, trackingHandler(tracking))
+	rounded := newTestExporter(address, ChronyCollectorConfig{CollectTracking: true, RoundDigits: 2})
+	// An exporter built later keeps its own precision and doesn't change the
+	// rounding of the first one.
+	full := newTestExporter(address, ChronyCollectorConfig{CollectTracking: true})
+
+	expectMetric(t, gatherMetrics(t, rounded), 0.012, "chrony_tracking_root_delay_seconds")
+	expectMetric(t, gatherMetrics(t, full), chronyFloatValue(tracking.RootDelay), "chrony_tracking_root_delay_seconds")
+}
@@ -0,0 +1,139 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/facebook/time/ntp/chrony"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The reply statuses of the chrony command protocol used by the exporter.
+const (
+	statusSuccess      chrony.ResponseStatusType = 0
+	statusUnauth       chrony.ResponseStatusType = 2
+	statusInvalid      chrony.ResponseStatusType = 3
+	statusNoSuchSource chrony.ResponseStatusType = 4
+
+	// replyStatusOffset is the offset of the status in the chrony reply
+	// header.
+	replyStatusOffset = 8
+)
+
+var (
+	errCommandUnsupported = errors.New("command not supported by chrony")
+
+	commandSupportedMetric = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "exporter", "command_supported"),
+			"Whether chrony supports a command, detected from the replies since startup.",
+			[]string{"command"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+)
+
+// statusError is a reply from chrony with an unsuccessful status.
+type statusError struct {
+	status chrony.ResponseStatusType
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("got status %s (%d)", e.status, e.status)
+}
+
+// hasStatus returns true when err is a reply from chrony with the status.
+func hasStatus(err error, status chrony.ResponseStatusType) bool {
+	var statusErr *statusError
+	return errors.As(err, &statusErr) && statusErr.status == status
+}
+
+// commandUnsupported returns true for errors of commands that chrony doesn't
+// support, replied to unknown commands and to commands that are not allowed
+// over the transport, such as ntpdata over UDP.
+func commandUnsupported(err error) bool {
+	return hasStatus(err, statusInvalid) || hasStatus(err, statusUnauth)
+}
+
+// exchange sends a single packet to chrony and decodes the reply, like
+// chrony.Client.Communicate.
+func exchange(client *chrony.Client, packet chrony.RequestPacket) (chrony.ResponsePacket, error) {
+	client.Sequence++
+	packet.SetSequence(client.Sequence)
+	if err := binary.Write(client.Connection, binary.BigEndian, packet); err != nil {
+		return nil, err
+	}
+	reply := make([]byte, 1024)
+	n, err := client.Connection.Read(reply)
+	if err != nil {
+		return nil, err
+	}
+	return decodeReply(packet, reply[:n])
+}
+
+// decodeReply decodes a raw reply to the packet. The chrony client only
+// returns an unsuccessful status as an error message, so it is returned as a
+// statusError instead.
+func decodeReply(packet chrony.RequestPacket, reply []byte) (chrony.ResponsePacket, error) {
+	if len(reply) >= replyStatusOffset+2 {
+		if status := chrony.ResponseStatusType(binary.BigEndian.Uint16(reply[replyStatusOffset:])); status != statusSuccess {
+			return nil, &statusError{status: status}
+		}
+	}
+	decoder := chrony.Client{Connection: replyConn{reply: reply}}
+	return decoder.Communicate(packet)
+}
+
+// commandSupport caches the commands chrony supports, so that unsupported
+// commands are skipped on later scrapes. It is shared by concurrent scrapes.
+type commandSupport struct {
+	mtx      sync.RWMutex
+	commands map[string]bool
+}
+
+func newCommandSupport() *commandSupport {
+	return &commandSupport{commands: make(map[string]bool)}
+}
+
+// supported returns false once chrony replied that the command is unsupported.
+func (c *commandSupport) supported(command string) bool {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	supported, ok := c.commands[command]
+	return !ok || supported
+}
+
+func (c *commandSupport) set(command string, supported bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.commands[command] = supported
+}
+
+// collect exports the detected support of each command sent so far.
+func (c *commandSupport) collect(ch chan<- prometheus.Metric, opts metricOptions) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	for command, supported := range c.commands {
+		value := 0.0
+		if supported {
+			value = 1.0
+		}
+		ch <- commandSupportedMetric.mustNewConstMetric(opts, value, command)
+	}
+}
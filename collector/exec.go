@@ -0,0 +1,250 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/facebook/time/ntp/chrony"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// execLeapStatus maps the chronyc leap status to the chrony LEAP values.
+	execLeapStatus = map[string]uint16{
+		"Normal":           0,
+		"Insert second":    1,
+		"Delete second":    2,
+		"Not synchronised": trackingLeapUnsynchronised,
+	}
+
+	// execSourceModes maps the chronyc sources mode column to the chrony modes.
+	execSourceModes = map[string]chrony.ModeType{
+		"^": chrony.SourceModeClient,
+		"=": chrony.SourceModePeer,
+		"#": chrony.SourceModeRef,
+	}
+
+	// execSourceStates maps the chronyc sources state column to the chrony
+	// states.
+	execSourceStates = map[string]chrony.SourceStateType{
+		"*": chrony.SourceStateSync,
+		"?": chrony.SourceStateUnreach,
+		"x": chrony.SourceStateFalseTicker,
+		"~": chrony.SourceStateJittery,
+		"+": chrony.SourceStateCandidate,
+		"-": chrony.SourceStateOutlier,
+	}
+)
+
+// runChronyc runs a chronyc command through the configured exec command with
+// numeric addresses and CSV output, and returns the CSV records.
+func (e Exporter) runChronyc(command string) ([][]string, error) {
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start)
+		e.commandDuration.WithLabelValues(command).Observe(duration.Seconds())
+		if e.timings != nil {
+			e.timings.command += duration
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+	args := slices.Concat(e.execCommand[1:], []string{"-n", "-c", command})
+	out, err := exec.CommandContext(ctx, e.execCommand[0], args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to run chronyc %s: %w", command, err)
+	}
+	return csv.NewReader(bytes.NewReader(out)).ReadAll()
+}
+
+// execAddress parses a chronyc address column. Reference clocks are shown by
+// their refid, which is encoded as an IPv4 address to match the command
+// protocol.
+func execAddress(s string) net.IP {
+	if ip := net.ParseIP(s); ip != nil {
+		return ip
+	}
+	ip := make(net.IP, net.IPv4len)
+	copy(ip, s)
+	return ip
+}
+
+// parseExecFloats parses the float columns of a chronyc CSV record.
+func parseExecFloats(record []string, columns map[int]*float64) error {
+	for column, value := range columns {
+		v, err := strconv.ParseFloat(record[column], 64)
+		if err != nil {
+			return fmt.Errorf("invalid column %d %q: %w", column+1, record[column], err)
+		}
+		*value = v
+	}
+	return nil
+}
+
+// parseExecTracking parses the `chronyc -n -c tracking` record of the form:
+//
+//	A29FC87B,162.159.200.123,3,1697040000.123456789,0.000012345,-0.000001234,0.000023456,-12.345,0.001,0.012,0.012345678,0.000678901,1024.5,Normal
+func parseExecTracking(record []string) (chrony.Tracking, error) {
+	var tracking chrony.Tracking
+	if len(record) < 14 {
+		return tracking, fmt.Errorf("expected 14 columns, got %d", len(record))
+	}
+
+	refID, err := strconv.ParseUint(record[0], 16, 32)
+	if err != nil {
+		return tracking, fmt.Errorf("invalid refid %q: %w", record[0], err)
+	}
+	tracking.RefID = uint32(refID)
+	tracking.IPAddr = net.ParseIP(record[1])
+	if tracking.IPAddr == nil {
+		tracking.IPAddr = net.IPv6unspecified
+	}
+	stratum, err := strconv.ParseUint(record[2], 10, 16)
+	if err != nil {
+		return tracking, fmt.Errorf("invalid stratum %q: %w", record[2], err)
+	}
+	tracking.Stratum = uint16(stratum)
+	leapStatus, ok := execLeapStatus[record[13]]
+	if !ok {
+		return tracking, fmt.Errorf("invalid leap status %q", record[13])
+	}
+	tracking.LeapStatus = leapStatus
+
+	var refTime float64
+	err = parseExecFloats(record, map[int]*float64{
+		3:  &refTime,
+		4:  &tracking.CurrentCorrection,
+		5:  &tracking.LastOffset,
+		6:  &tracking.RMSOffset,
+		7:  &tracking.FreqPPM,
+		8:  &tracking.ResidFreqPPM,
+		9:  &tracking.SkewPPM,
+		10: &tracking.RootDelay,
+		11: &tracking.RootDispersion,
+		12: &tracking.LastUpdateInterval,
+	})
+	if err != nil {
+		return tracking, err
+	}
+	sec, frac := math.Modf(refTime)
+	tracking.RefTime = time.Unix(int64(sec), int64(frac*1e9))
+	return tracking, nil
+}
+
+// parseExecSource parses a `chronyc -n -c sources` record of the form:
+//
+//	^,*,203.0.113.15,2,10,377,535,-0.000010212,-0.000011046,0.023957522
+func parseExecSource(record []string) (chrony.SourceData, error) {
+	var source chrony.SourceData
+	if len(record) < 10 {
+		return source, fmt.Errorf("expected 10 columns, got %d", len(record))
+	}
+
+	mode, ok := execSourceModes[record[0]]
+	if !ok {
+		return source, fmt.Errorf("invalid mode %q", record[0])
+	}
+	source.Mode = mode
+	state, ok := execSourceStates[record[1]]
+	if !ok {
+		return source, fmt.Errorf("invalid state %q", record[1])
+	}
+	source.State = state
+	source.IPAddr = execAddress(record[2])
+
+	stratum, err := strconv.ParseUint(record[3], 10, 16)
+	if err != nil {
+		return source, fmt.Errorf("invalid stratum %q: %w", record[3], err)
+	}
+	source.Stratum = uint16(stratum)
+	poll, err := strconv.ParseInt(record[4], 10, 16)
+	if err != nil {
+		return source, fmt.Errorf("invalid poll %q: %w", record[4], err)
+	}
+	source.Poll = int16(poll)
+	reach, err := strconv.ParseUint(record[5], 8, 16)
+	if err != nil {
+		return source, fmt.Errorf("invalid reach %q: %w", record[5], err)
+	}
+	source.Reachability = uint16(reach)
+	// chronyc shows "-" for sources without a sample.
+	source.SinceSample = math.MaxUint32
+	if record[6] != "-" {
+		sinceSample, err := strconv.ParseUint(record[6], 10, 32)
+		if err != nil {
+			return source, fmt.Errorf("invalid last sample %q: %w", record[6], err)
+		}
+		source.SinceSample = uint32(sinceSample)
+	}
+
+	err = parseExecFloats(record, map[int]*float64{
+		7: &source.LatestMeas,
+		8: &source.OrigLatestMeas,
+		9: &source.LatestMeasErr,
+	})
+	return source, err
+}
+
+// getExecTrackingMetrics exports the tracking metrics from `chronyc tracking`
+// and returns the selected source.
+func (e Exporter) getExecTrackingMetrics(logger *slog.Logger, ch chan<- prometheus.Metric) (trackingSelection, error) {
+	start := time.Now()
+	records, err := e.runChronyc("tracking")
+	if err != nil {
+		return trackingSelection{}, err
+	}
+	if len(records) != 1 {
+		return trackingSelection{}, fmt.Errorf("Got %d 'tracking' records, expected 1", len(records))
+	}
+	tracking, err := parseExecTracking(records[0])
+	if err != nil {
+		return trackingSelection{}, fmt.Errorf("Unable to parse 'tracking' record %q: %w", strings.Join(records[0], ","), err)
+	}
+	logger.Debug("Got 'tracking' record", "tracking_refid", chrony.RefidAsHEX(tracking.RefID))
+	return e.exportTrackingMetrics(logger, ch, nil, start, tracking), nil
+}
+
+// getExecSourcesMetrics exports the sources metrics from `chronyc sources`.
+func (e Exporter) getExecSourcesMetrics(logger *slog.Logger, ch chan<- prometheus.Metric) error {
+	records, err := e.runChronyc("sources")
+	if err != nil {
+		return err
+	}
+	scrapeTime := time.Now()
+	results := make([]chrony.ReplySourceData, 0, len(records))
+	for _, record := range records {
+		source, err := parseExecSource(record)
+		if err != nil {
+			// Skip sources that can't be parsed rather than failing all sources.
+			logger.Debug("Unable to parse 'sources' record", "record", strings.Join(record, ","), "err", err)
+			continue
+		}
+		results = append(results, chrony.ReplySourceData{SourceData: source})
+	}
+	e.exportSourcesMetrics(logger, ch, nil, nil, scrapeTime, results)
+	return nil
+}
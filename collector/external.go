@@ -0,0 +1,124 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/facebook/time/ntp/protocol"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	externalSubsystem = "external"
+
+	// NTPv4 client request, LI 0, VN 4, Mode 3.
+	externalRequestSettings = 0x23
+)
+
+var (
+	externalOffset = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, externalSubsystem, "offset_seconds"),
+			"Offset of the local clock measured by the exporter against an external NTP server, positive when the local clock is fast relative to the server",
+			[]string{"server"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+)
+
+// queryExternalNTP performs a single NTP client exchange with the server and
+// returns the measured clock offset with chronyd's sign convention, positive
+// when the local clock is fast relative to the server.
+func (e Exporter) queryExternalNTP(server string) (time.Duration, error) {
+	address := server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		address = net.JoinHostPort(server, "123")
+	}
+	conn, err := net.DialTimeout("udp", address, e.timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(e.timeout)); err != nil {
+		return 0, err
+	}
+
+	origin := time.Now()
+	txSec, txFrac := protocol.Time(origin)
+	request := &protocol.Packet{
+		Settings:   externalRequestSettings,
+		TxTimeSec:  txSec,
+		TxTimeFrac: txFrac,
+	}
+	b, err := request.Bytes()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := conn.Write(b); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, protocol.PacketSizeBytes)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return 0, err
+	}
+	clientReceive := time.Now()
+	response, err := protocol.BytesToPacket(buf[:n])
+	if err != nil {
+		return 0, err
+	}
+	if response.OrigTimeSec != txSec || response.OrigTimeFrac != txFrac {
+		return 0, fmt.Errorf("response origin timestamp does not match request")
+	}
+
+	offset := protocol.Offset(
+		origin,
+		protocol.Unix(response.RxTimeSec, response.RxTimeFrac),
+		protocol.Unix(response.TxTimeSec, response.TxTimeFrac),
+		clientReceive,
+	)
+	// protocol.Offset is positive when the server is ahead.
+	return -time.Duration(offset), nil
+}
+
+// getExternalMetrics queries the external NTP servers concurrently, so a
+// slow server doesn't delay the others.
+func (e Exporter) getExternalMetrics(logger *slog.Logger, ch chan<- prometheus.Metric) {
+	offsets := make([]time.Duration, len(e.externalNTPServers))
+	errs := make([]error, len(e.externalNTPServers))
+	var wg sync.WaitGroup
+	for i, server := range e.externalNTPServers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			offsets[i], errs[i] = e.queryExternalNTP(server)
+		}()
+	}
+	wg.Wait()
+
+	for i, server := range e.externalNTPServers {
+		if errs[i] != nil {
+			logger.Debug("Couldn't query external NTP server", "server", server, "err", errs[i])
+			continue
+		}
+		ch <- externalOffset.mustNewConstMetric(e.metricOpts, offsets[i].Seconds(), server)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/facebook/time/ntp/protocol"
+)
+
+// newFakeNTPServer starts an NTP server whose clock is skew ahead of the
+// local clock and that replies after delay.
+func newFakeNTPServer(tb testing.TB, skew, delay time.Duration) string {
+	tb.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			request, err := protocol.BytesToPacket(buf[:n])
+			if err != nil {
+				continue
+			}
+			time.Sleep(delay)
+			sec, frac := protocol.Time(time.Now().Add(skew))
+			response := &protocol.Packet{
+				Settings:     0x24,
+				Stratum:      1,
+				OrigTimeSec:  request.TxTimeSec,
+				OrigTimeFrac: request.TxTimeFrac,
+				RxTimeSec:    sec,
+				RxTimeFrac:   frac,
+				TxTimeSec:    sec,
+				TxTimeFrac:   frac,
+			}
+			b, err := response.Bytes()
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(b, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestExternalOffsetSign(t *testing.T) {
+	ahead := newFakeNTPServer(t, time.Second, 0)
+	behind := newFakeNTPServer(t, -time.Second, 0)
+	address := newFakeChrony(t, sourcesHandler(nil))
+	e := newTestExporter(address, ChronyCollectorConfig{ExternalNTPServers: []string{ahead, behind}})
+	families := gatherMetrics(t, e)
+
+	for _, tc := range []struct {
+		server string
+		want   float64
+	}{
+		// The local clock is slow relative to a server that is ahead.
+		{server: ahead, want: -1},
+		{server: behind, want: 1},
+	} {
+		got, ok := metricValue(families, "chrony_external_offset_seconds", "server", tc.server)
+		if !ok {
+			t.Errorf("chrony_external_offset_seconds{server=%q}: missing", tc.server)
+			continue
+		}
+		if got < tc.want-0.1 || got > tc.want+0.1 {
+			t.Errorf("chrony_external_offset_seconds{server=%q}: got %g, want %g", tc.server, got, tc.want)
+		}
+	}
+}
+
+func TestExternalServersConcurrent(t *testing.T) {
+	const delay = 500 * time.Millisecond
+	var servers []string
+	for range 4 {
+		servers = append(servers, newFakeNTPServer(t, 0, delay))
+	}
+	address := newFakeChrony(t, sourcesHandler(nil))
+	e := newTestExporter(address, ChronyCollectorConfig{ExternalNTPServers: servers, Timeout: 5 * time.Second})
+
+	start := time.Now()
+	families := gatherMetrics(t, e)
+	if elapsed := time.Since(start); elapsed > 2*delay {
+		t.Errorf("scrape took %s, want the %d servers queried concurrently", elapsed, len(servers))
+	}
+	if n := metricCount(families, "chrony_external_offset_seconds"); n != len(servers) {
+		t.Errorf("chrony_external_offset_seconds: got %d servers, want %d", n, len(servers))
+	}
+}
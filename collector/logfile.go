@@ -0,0 +1,151 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	logfileTracking = "tracking.log"
+
+	// logfileTailBytes is the amount read from the end of a log file to
+	// find the latest entry.
+	logfileTailBytes = 4096
+
+	// trackingLogTimeLayout is the format of the date and time columns.
+	trackingLogTimeLayout = "2006-01-02 15:04:05"
+)
+
+// trackingLogEntry holds the columns of a tracking.log line that map to
+// the tracking metrics.
+type trackingLogEntry struct {
+	time           time.Time
+	stratum        float64
+	freqPPM        float64
+	skewPPM        float64
+	offset         float64
+	rootDelay      float64
+	rootDispersion float64
+}
+
+// lastLogLine returns the last line of the file accepted by valid. The file
+// is opened on every call so that rotated logs are followed.
+func lastLogLine(path string, valid func(string) bool) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	offset := max(stat.Size()-logfileTailBytes, 0)
+	buf := make([]byte, stat.Size()-offset)
+	if _, err := f.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return "", err
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(buf), []byte("\n"))
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := string(lines[i]); valid(line) {
+			return line, nil
+		}
+	}
+	return "", fmt.Errorf("no entries found in %s", path)
+}
+
+// isTrackingLogEntry skips the "====" separators and column headers.
+func isTrackingLogEntry(line string) bool {
+	return len(line) > 0 && line[0] >= '0' && line[0] <= '9'
+}
+
+// parseTrackingLogLine parses a tracking.log line of the form:
+//
+//	Date (UTC) Time     IP Address   St   Freq ppm   Skew ppm     Offset L Co  Offset sd Rem. corr. Root delay Root disp. Max. error
+//	2017-08-22 13:22:36 203.0.113.15     2     -3.541      0.075 -8.621e-06 N  2  2.940e-06 -2.084e-06  1.504e-03  3.825e-04  4.389e-04
+func parseTrackingLogLine(line string) (trackingLogEntry, error) {
+	var entry trackingLogEntry
+	fields := strings.Fields(line)
+	if len(fields) < 13 {
+		return entry, fmt.Errorf("expected at least 13 columns, got %d", len(fields))
+	}
+
+	t, err := time.Parse(trackingLogTimeLayout, fields[0]+" "+fields[1])
+	if err != nil {
+		return entry, err
+	}
+	entry.time = t
+
+	for _, v := range []struct {
+		field int
+		value *float64
+	}{
+		{3, &entry.stratum},
+		{4, &entry.freqPPM},
+		{5, &entry.skewPPM},
+		{6, &entry.offset},
+		{11, &entry.rootDelay},
+		{12, &entry.rootDispersion},
+	} {
+		*v.value, err = strconv.ParseFloat(fields[v.field], 64)
+		if err != nil {
+			return entry, fmt.Errorf("invalid column %d %q: %w", v.field+1, fields[v.field], err)
+		}
+	}
+	return entry, nil
+}
+
+// getTrackingLogMetrics exports the tracking metrics from the latest
+// tracking.log entry in the chrony logdir.
+func (e Exporter) getTrackingLogMetrics(logger *slog.Logger, ch chan<- prometheus.Metric) error {
+	path := filepath.Join(e.logfilePath, logfileTracking)
+	line, err := lastLogLine(path, isTrackingLogEntry)
+	if err != nil {
+		return err
+	}
+	entry, err := parseTrackingLogLine(line)
+	if err != nil {
+		return fmt.Errorf("Unable to parse %s line %q: %w", path, line, err)
+	}
+	logger.Debug("Got tracking log entry", "file", path, "time", entry.time)
+
+	ch <- trackingLastOffset.mustNewConstMetric(e.metricOpts, entry.offset)
+	if e.offsetBaseline != nil {
+		ch <- trackingOffsetDeviation.mustNewConstMetric(e.metricOpts, e.offsetBaseline.deviation(entry.time, entry.offset))
+	}
+	ch <- trackingRefTime.mustNewConstMetric(e.metricOpts, float64(entry.time.Unix()))
+	if e.timestampsMilliseconds {
+		ch <- trackingRefTimeMilliseconds.mustNewConstMetric(e.metricOpts, float64(entry.time.UnixMilli()))
+	}
+	ch <- trackingRootDelay.mustNewConstMetric(e.metricOpts, entry.rootDelay)
+	ch <- trackingRootDispersion.mustNewConstMetric(e.metricOpts, entry.rootDispersion)
+	ch <- trackingFrequency.mustNewConstMetric(e.metricOpts, entry.freqPPM)
+	ch <- trackingSkew.mustNewConstMetric(e.metricOpts, entry.skewPPM)
+	ch <- trackingStratum.mustNewConstMetric(e.metricOpts, entry.stratum)
+
+	return nil
+}
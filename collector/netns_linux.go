@@ -0,0 +1,76 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// netnsPath returns the path of a named network namespace, as created by
+// `ip netns add`, or the name itself when it is an absolute path.
+func netnsPath(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join("/run/netns", name)
+}
+
+// inNetns runs fn inside the given network namespace. Namespaces are per
+// thread, so fn runs on a dedicated goroutine locked to its OS thread. Sockets
+// opened by fn stay in the namespace after returning.
+func inNetns(name string, fn func()) error {
+	errCh := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+
+		orig, err := os.Open("/proc/thread-self/ns/net")
+		if err != nil {
+			runtime.UnlockOSThread()
+			errCh <- fmt.Errorf("unable to open current network namespace: %w", err)
+			return
+		}
+		defer orig.Close()
+
+		target, err := os.Open(netnsPath(name))
+		if err != nil {
+			runtime.UnlockOSThread()
+			errCh <- fmt.Errorf("unable to open network namespace: %w", err)
+			return
+		}
+		defer target.Close()
+
+		if err := unix.Setns(int(target.Fd()), unix.CLONE_NEWNET); err != nil {
+			runtime.UnlockOSThread()
+			errCh <- fmt.Errorf("unable to enter network namespace %q: %w", name, err)
+			return
+		}
+
+		fn()
+
+		// If the original namespace can't be restored, leave the thread
+		// locked so that the runtime terminates it with this goroutine.
+		if err := unix.Setns(int(orig.Fd()), unix.CLONE_NEWNET); err == nil {
+			runtime.UnlockOSThread()
+		}
+		errCh <- nil
+	}()
+	return <-errCh
+}
@@ -0,0 +1,26 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+
+package collector
+
+import (
+	"errors"
+)
+
+// inNetns fails on platforms without network namespaces, rather than
+// silently dialing in the current namespace.
+func inNetns(name string, fn func()) error {
+	return errors.New("network namespaces are only supported on Linux")
+}
@@ -0,0 +1,93 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// sourceOffsets keeps the last sample offsets of each source within a
+// sliding window. It is shared by concurrent scrapes.
+type sourceOffsets struct {
+	mtx       sync.Mutex
+	window    time.Duration
+	quantiles []float64
+	sources   map[string][]offsetSample
+}
+
+func newSourceOffsets(window time.Duration, quantiles []float64) *sourceOffsets {
+	return &sourceOffsets{
+		window:    window,
+		quantiles: quantiles,
+		sources:   make(map[string][]offsetSample),
+	}
+}
+
+// observe records the offset of the source sample at t, and returns the
+// count, sum and quantiles of the offsets within the window. The sample time
+// is derived from the sample age in whole seconds, so repeated scrapes of the
+// same sample are detected by an unchanged offset within a second.
+func (o *sourceOffsets) observe(source string, t time.Time, offset float64) (uint64, float64, map[float64]float64) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	samples := o.sources[source]
+	if n := len(samples); n == 0 || samples[n-1].offset != offset || t.Sub(samples[n-1].time) > time.Second {
+		samples = append(samples, offsetSample{time: t, offset: offset})
+	}
+	cutoff := t.Add(-o.window)
+	i := 0
+	for i < len(samples) && samples[i].time.Before(cutoff) {
+		i++
+	}
+	samples = samples[i:]
+	o.sources[source] = samples
+
+	offsets := make([]float64, len(samples))
+	var sum float64
+	for i, s := range samples {
+		offsets[i] = s.offset
+		sum += s.offset
+	}
+	slices.Sort(offsets)
+	quantiles := make(map[float64]float64, len(o.quantiles))
+	for _, q := range o.quantiles {
+		quantiles[q] = offsetQuantile(offsets, q)
+	}
+	return uint64(len(offsets)), sum, quantiles
+}
+
+// retain evicts the sources that are not in the given set, such as sources
+// removed from the chrony configuration.
+func (o *sourceOffsets) retain(sources map[string]bool) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	for source := range o.sources {
+		if !sources[source] {
+			delete(o.sources, source)
+		}
+	}
+}
+
+// offsetQuantile returns the nearest-rank quantile of the sorted offsets.
+func offsetQuantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
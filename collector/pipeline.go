@@ -0,0 +1,124 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/facebook/time/ntp/chrony"
+)
+
+const (
+	// pipelineWindow is the number of requests sent before reading their
+	// replies. chrony drops replies it can't send without blocking, and Linux
+	// only queues a few datagrams on a unix socket by default.
+	pipelineWindow = 8
+
+	// replySequenceOffset is the offset of the sequence in the chrony reply
+	// header.
+	replySequenceOffset = 16
+)
+
+// replyConn replays a single received reply to the chrony client, so that
+// the client decodes it. Writes are discarded.
+type replyConn struct {
+	reply []byte
+}
+
+func (c replyConn) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (c replyConn) Read(p []byte) (int, error) {
+	return copy(p, c.reply), nil
+}
+
+// replySequence returns the sequence of a raw chrony reply.
+func replySequence(reply []byte) (uint32, bool) {
+	if len(reply) < replySequenceOffset+4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(reply[replySequenceOffset:]), true
+}
+
+// communicatePipelined sends the packets without waiting for each reply, in
+// windows of pipelineWindow requests, and matches the replies to the
+// requests by sequence. The replies and errors are returned in the order of
+// the packets. An error is only returned when the exchange itself fails.
+func (e Exporter) communicatePipelined(client *chrony.Client, command string, packets []chrony.RequestPacket) ([]chrony.ResponsePacket, []error, error) {
+	if !e.commands.supported(command) {
+		return nil, nil, fmt.Errorf("%w: %s", errCommandUnsupported, command)
+	}
+	replies := make([]chrony.ResponsePacket, len(packets))
+	errs := make([]error, len(packets))
+	for start := 0; start < len(packets); start += pipelineWindow {
+		end := min(start+pipelineWindow, len(packets))
+		if err := e.communicateWindow(client, command, packets[start:end], replies[start:end], errs[start:end]); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, err := range errs {
+		if err != nil && commandUnsupported(err) {
+			e.commands.set(command, false)
+			return nil, nil, fmt.Errorf("%w: %s: %w", errCommandUnsupported, command, err)
+		}
+	}
+	if len(packets) > 0 {
+		e.commands.set(command, true)
+	}
+	return replies, errs, nil
+}
+
+// communicateWindow sends a window of packets and reads their replies,
+// recording the round-trip duration of the window under the command name.
+func (e Exporter) communicateWindow(client *chrony.Client, command string, packets []chrony.RequestPacket, replies []chrony.ResponsePacket, errs []error) error {
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start)
+		e.commandDuration.WithLabelValues(command).Observe(duration.Seconds())
+		if e.timings != nil {
+			e.timings.command += duration
+		}
+	}()
+
+	first := client.Sequence + 1
+	for _, packet := range packets {
+		client.Sequence++
+		packet.SetSequence(client.Sequence)
+		if err := binary.Write(client.Connection, binary.BigEndian, packet); err != nil {
+			return err
+		}
+	}
+
+	received := make([]bool, len(packets))
+	buf := make([]byte, 1024)
+	for pending := len(packets); pending > 0; {
+		n, err := client.Connection.Read(buf)
+		if err != nil {
+			return err
+		}
+		sequence, ok := replySequence(buf[:n])
+		i := sequence - first
+		if !ok || i >= uint32(len(packets)) || received[i] {
+			// A late or duplicate reply to another request.
+			continue
+		}
+		replies[i], errs[i] = decodeReply(packets[i], buf[:n])
+		received[i] = true
+		pending--
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"testing"
+)
+
+func TestSourcesBatch(t *testing.T) {
+	sources := newTestSources(benchmarkSources)
+	address := newFakeChrony(t, sourcesHandler(sources))
+	expectSources(t, newTestExporter(address, ChronyCollectorConfig{SourcesBatch: true}), sources)
+}
+
+// BenchmarkSourcesBatch compares with BenchmarkSourcesSerial.
+func BenchmarkSourcesBatch(b *testing.B) {
+	benchmarkSourceData(b, ChronyCollectorConfig{SourcesBatch: true})
+}
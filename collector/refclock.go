@@ -0,0 +1,65 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/binary"
+	"log/slog"
+
+	"github.com/facebook/time/ntp/chrony"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	refclockSubsystem = "refclock"
+)
+
+var (
+	refclockLocked = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, refclockSubsystem, "locked"),
+			"Chrony reference clock produced a valid sample in the last poll",
+			[]string{"driver"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	refclockOffset = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, refclockSubsystem, "offset_seconds"),
+			"Chrony reference clock last sample offset in seconds",
+			[]string{"driver"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+)
+
+// getRefclockMetrics exports the status of the reference clock sources,
+// labelled with their refid, which chrony derives from the driver name. The
+// command protocol has no refclock lock status, so a refclock is considered
+// locked when its last poll produced a valid sample.
+func (e Exporter) getRefclockMetrics(logger *slog.Logger, ch chan<- prometheus.Metric, sources []chrony.ReplySourceData) {
+	for _, r := range sources {
+		if r.Mode != chrony.SourceModeRef || r.IPAddr.To4() == nil {
+			continue
+		}
+
+		driver := chrony.RefidToString(binary.BigEndian.Uint32(r.IPAddr.To4()))
+		logger.Debug("Got reference clock", "driver", driver, "reachability", r.Reachability)
+		ch <- refclockLocked.mustNewConstMetric(e.metricOpts, float64(r.Reachability&1), driver)
+		ch <- refclockOffset.mustNewConstMetric(e.metricOpts, r.LatestMeas, driver)
+	}
+}
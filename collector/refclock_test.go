@@ -0,0 +1,80 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/facebook/time/ntp/chrony"
+)
+
+// newTestRefclock returns a reference clock source with the refid, which
+// chrony encodes as an IPv4 address.
+func newTestRefclock(refID string, reachability uint16, offset float64) fakeSourceData {
+	var address [net.IPv4len]byte
+	copy(address[:], refID)
+	return fakeSourceData{
+		IPAddr:       newFakeIPAddr(net.IP(address[:]).String()),
+		State:        chrony.SourceStateSync,
+		Mode:         chrony.SourceModeRef,
+		Reachability: reachability,
+		LatestMeas:   toChronyFloat(offset),
+	}
+}
+
+func TestRefclock(t *testing.T) {
+	sources := append(newTestSources(1),
+		newTestRefclock("PPS0", 0377, -0.25),
+		newTestRefclock("GPS", 0376, 0.5),
+	)
+	handle := sourcesHandler(sources)
+	var sourcesRequests atomic.Int32
+	address := newFakeChrony(t, func(req fakeRequest) []byte {
+		if req.command == fakeReqSources {
+			sourcesRequests.Add(1)
+			// A source removed before the enumeration.
+			return fakeReply(req, chrony.RpyNSources, statusSuccess, uint32(len(sources)+1))
+		}
+		return handle(req)
+	})
+	e := newTestExporter(address, ChronyCollectorConfig{CollectSources: true, CollectRefclock: true})
+	families := gatherMetrics(t, e)
+
+	expectMetric(t, families, 1, "chrony_up")
+	expectMetric(t, families, 1, "chrony_collector_up", "collector", "refclock")
+	expectMetric(t, families, 1, "chrony_refclock_locked", "driver", "PPS0")
+	expectMetric(t, families, -0.25, "chrony_refclock_offset_seconds", "driver", "PPS0")
+	expectMetric(t, families, 0, "chrony_refclock_locked", "driver", "GPS")
+	expectMetric(t, families, 0.5, "chrony_refclock_offset_seconds", "driver", "GPS")
+	if n := metricCount(families, "chrony_refclock_locked"); n != 2 {
+		t.Errorf("chrony_refclock_locked: got %d refclocks, want 2", n)
+	}
+	if n := sourcesRequests.Load(); n != 1 {
+		t.Errorf("got %d sources requests, want 1", n)
+	}
+}
+
+func TestRefclockNone(t *testing.T) {
+	address := newFakeChrony(t, sourcesHandler(newTestSources(2)))
+	e := newTestExporter(address, ChronyCollectorConfig{CollectRefclock: true})
+	families := gatherMetrics(t, e)
+
+	expectMetric(t, families, 1, "chrony_up")
+	expectMetric(t, families, 1, "chrony_collector_up", "collector", "refclock")
+	if n := metricCount(families, "chrony_refclock_locked"); n != 0 {
+		t.Errorf("chrony_refclock_locked: got %d refclocks, want 0", n)
+	}
+}
@@ -26,6 +26,26 @@ const (
 )
 
 var (
+	serverstatsIsServer = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "is_server"),
+			"Whether chrony is serving NTP clients, 1 when it received any valid NTP requests since it started.",
+			nil,
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	serverstatsVersion = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, serverstatsSubsystem, "version"),
+			"The version of the serverstats reply received from the server, from 1 to 4. Newer versions have more fields.",
+			nil,
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
 	serverstatsNTPHits = typedDesc{
 		prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, serverstatsSubsystem, "ntp_packets_received_total"),
@@ -236,7 +256,7 @@ func parseServerStatsPacket(p chrony.ResponsePacket) (chrony.ReplyServerStats4,
 }
 
 func (e Exporter) getServerstatsMetrics(logger *slog.Logger, ch chan<- prometheus.Metric, client chrony.Client) error {
-	packet, err := client.Communicate(chrony.NewServerStatsPacket())
+	packet, err := e.communicate(&client, "serverstats", chrony.NewServerStatsPacket())
 	if err != nil {
 		return err
 	}
@@ -247,54 +267,73 @@ func (e Exporter) getServerstatsMetrics(logger *slog.Logger, ch chan<- prometheu
 		return fmt.Errorf("Unable to parse 'serverstats' packet: %w", err)
 	}
 
+	isServer := 0.0
+	if serverstats.NTPHits > 0 {
+		isServer = 1.0
+	}
+	ch <- serverstatsIsServer.mustNewConstMetric(e.metricOpts, isServer)
+
+	var version float64
+	switch packet.(type) {
+	case *chrony.ReplyServerStats:
+		version = 1
+	case *chrony.ReplyServerStats2:
+		version = 2
+	case *chrony.ReplyServerStats3:
+		version = 3
+	case *chrony.ReplyServerStats4:
+		version = 4
+	}
+	ch <- serverstatsVersion.mustNewConstMetric(e.metricOpts, version)
+
 	// Stats that only exist in all versions.
-	ch <- serverstatsNTPHits.mustNewConstMetric(float64(serverstats.NTPHits))
+	ch <- serverstatsNTPHits.mustNewConstMetric(e.metricOpts, float64(serverstats.NTPHits))
 	logger.Debug("Serverstats NTP Hits", "ntp_hits", serverstats.NTPHits)
-	ch <- serverstatsCMDHits.mustNewConstMetric(float64(serverstats.CMDHits))
+	ch <- serverstatsCMDHits.mustNewConstMetric(e.metricOpts, float64(serverstats.CMDHits))
 	logger.Debug("Serverstats CMD Hits", "cmd_hits", serverstats.CMDHits)
-	ch <- serverstatsNTPDrops.mustNewConstMetric(float64(serverstats.NTPDrops))
+	ch <- serverstatsNTPDrops.mustNewConstMetric(e.metricOpts, float64(serverstats.NTPDrops))
 	logger.Debug("Serverstats NTP Drops", "ntp_drops", serverstats.NTPDrops)
-	ch <- serverstatsCMDDrops.mustNewConstMetric(float64(serverstats.CMDDrops))
+	ch <- serverstatsCMDDrops.mustNewConstMetric(e.metricOpts, float64(serverstats.CMDDrops))
 	logger.Debug("Serverstats CMD Drops", "cmd_drops", serverstats.CMDDrops)
-	ch <- serverstatsLogDrops.mustNewConstMetric(float64(serverstats.LogDrops))
+	ch <- serverstatsLogDrops.mustNewConstMetric(e.metricOpts, float64(serverstats.LogDrops))
 	logger.Debug("Serverstats Log Drops", "log_drops", serverstats.LogDrops)
 
 	// Stats added in chrony.ReplyServerStats2
 	switch packet.(type) {
 	case *chrony.ReplyServerStats2, *chrony.ReplyServerStats3, *chrony.ReplyServerStats4:
-		ch <- serverstatsNKEHits.mustNewConstMetric(float64(serverstats.NKEHits))
+		ch <- serverstatsNKEHits.mustNewConstMetric(e.metricOpts, float64(serverstats.NKEHits))
 		logger.Debug("Serverstats NKE Hits", "nke_hits", serverstats.NKEHits)
-		ch <- serverstatsNKEDrops.mustNewConstMetric(float64(serverstats.NKEDrops))
+		ch <- serverstatsNKEDrops.mustNewConstMetric(e.metricOpts, float64(serverstats.NKEDrops))
 		logger.Debug("Serverstats NKE Drops", "nke_drops", serverstats.NKEDrops)
-		ch <- serverstatsNTPAuthHits.mustNewConstMetric(float64(serverstats.NTPAuthHits))
+		ch <- serverstatsNTPAuthHits.mustNewConstMetric(e.metricOpts, float64(serverstats.NTPAuthHits))
 		logger.Debug("Serverstats Authenticated Packets", "auth_hits", serverstats.NTPAuthHits)
 	}
 
 	// Stats added in chrony.ReplyServerStats3
 	switch packet.(type) {
 	case *chrony.ReplyServerStats3, *chrony.ReplyServerStats4:
-		ch <- serverstatsNTPInterleavedHits.mustNewConstMetric(float64(serverstats.NTPInterleavedHits))
+		ch <- serverstatsNTPInterleavedHits.mustNewConstMetric(e.metricOpts, float64(serverstats.NTPInterleavedHits))
 		logger.Debug("Serverstats Interleaved Packets", "interleaved_hits", serverstats.NTPInterleavedHits)
-		ch <- serverstatsNTPTimestamps.mustNewConstMetric(float64(serverstats.NTPTimestamps))
+		ch <- serverstatsNTPTimestamps.mustNewConstMetric(e.metricOpts, float64(serverstats.NTPTimestamps))
 		logger.Debug("Serverstats Timestamps Held", "ntp_timestamps_held", serverstats.NTPTimestamps)
-		ch <- serverstatsNTPSpanSeconds.mustNewConstMetric(float64(serverstats.NTPSpanSeconds))
+		ch <- serverstatsNTPSpanSeconds.mustNewConstMetric(e.metricOpts, float64(serverstats.NTPSpanSeconds))
 		logger.Debug("Serverstats Timestamps Span", "ntp_timestamps_span", serverstats.NTPSpanSeconds)
 	}
 
 	// Stats added in chrony.ReplyServerStats4
 	switch packet.(type) {
 	case *chrony.ReplyServerStats4:
-		ch <- serverstatsNTPDaemonRxTimestamps.mustNewConstMetric(float64(serverstats.NTPDaemonRxtimestamps))
+		ch <- serverstatsNTPDaemonRxTimestamps.mustNewConstMetric(e.metricOpts, float64(serverstats.NTPDaemonRxtimestamps))
 		logger.Debug("Serverstats Daemon Rx Timestamps", "ntp_daemon_rx_timestamps", serverstats.NTPDaemonRxtimestamps)
-		ch <- serverstatsNTPDaemonTxTimestamps.mustNewConstMetric(float64(serverstats.NTPDaemonTxtimestamps))
+		ch <- serverstatsNTPDaemonTxTimestamps.mustNewConstMetric(e.metricOpts, float64(serverstats.NTPDaemonTxtimestamps))
 		logger.Debug("Serverstats Daemon Tx Timestamps", "ntp_daemon_tx_timestamps", serverstats.NTPDaemonTxtimestamps)
-		ch <- serverstatsNTPKernelRxTimestamps.mustNewConstMetric(float64(serverstats.NTPKernelRxtimestamps))
+		ch <- serverstatsNTPKernelRxTimestamps.mustNewConstMetric(e.metricOpts, float64(serverstats.NTPKernelRxtimestamps))
 		logger.Debug("Serverstats Kernel Rx Timestamps", "ntp_kernel_rx_timestamps", serverstats.NTPKernelRxtimestamps)
-		ch <- serverstatsNTPKernelTxTimestamps.mustNewConstMetric(float64(serverstats.NTPKernelTxtimestamps))
+		ch <- serverstatsNTPKernelTxTimestamps.mustNewConstMetric(e.metricOpts, float64(serverstats.NTPKernelTxtimestamps))
 		logger.Debug("Serverstats Kernel Tx Timestamps", "ntp_kernel_tx_timestamps", serverstats.NTPKernelTxtimestamps)
-		ch <- serverstatsNTPHwRxTimestamps.mustNewConstMetric(float64(serverstats.NTPHwRxTimestamps))
+		ch <- serverstatsNTPHwRxTimestamps.mustNewConstMetric(e.metricOpts, float64(serverstats.NTPHwRxTimestamps))
 		logger.Debug("Serverstats Hardware Rx Timestamps", "ntp_hw_rx_timestamps", serverstats.NTPHwRxTimestamps)
-		ch <- serverstatsNTPHwTxTimestamps.mustNewConstMetric(float64(serverstats.NTPHwTxTimestamps))
+		ch <- serverstatsNTPHwTxTimestamps.mustNewConstMetric(e.metricOpts, float64(serverstats.NTPHwTxTimestamps))
 		logger.Debug("Serverstats Hardware Tx Timestamps", "ntp_hw_tx_timestamps", serverstats.NTPHwTxTimestamps)
 	}
 
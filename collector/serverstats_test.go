@@ -0,0 +1,155 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"testing"
+
+	"github.com/facebook/time/ntp/chrony"
+)
+
+// serverstatsHandler replies to the serverstats requests with the stats, and
+// to other requests as invalid.
+func serverstatsHandler(reply chrony.ReplyType, stats any) fakeHandler {
+	return func(req fakeRequest) []byte {
+		if req.command == fakeReqServerStats {
+			return fakeReply(req, reply, statusSuccess, stats)
+		}
+		return fakeStatus(req, statusInvalid)
+	}
+}
+
+func TestServerstatsFields(t *testing.T) {
+	// Each field has a distinct value, so a field exported as another metric
+	// is detected.
+	stats := chrony.ServerStats4{
+		NTPHits:               1,
+		NKEHits:               2,
+		CMDHits:               3,
+		NTPDrops:              4,
+		NKEDrops:              5,
+		CMDDrops:              6,
+		LogDrops:              7,
+		NTPAuthHits:           8,
+		NTPInterleavedHits:    9,
+		NTPTimestamps:         10,
+		NTPSpanSeconds:        11,
+		NTPDaemonRxtimestamps: 12,
+		NTPDaemonTxtimestamps: 13,
+		NTPKernelRxtimestamps: 14,
+		NTPKernelTxtimestamps: 15,
+		NTPHwRxTimestamps:     16,
+		NTPHwTxTimestamps:     1 << 40,
+	}
+	address := newFakeChrony(t, serverstatsHandler(chrony.RpyServerStats4, stats))
+	families := gatherMetrics(t, newTestExporter(address, ChronyCollectorConfig{CollectServerstats: true}))
+
+	expectMetric(t, families, 1, "chrony_collector_up", "collector", "serverstats")
+	expectMetric(t, families, 1, "chrony_is_server")
+	expectMetric(t, families, 4, "chrony_serverstats_version")
+	// Every field of the serverstats4 reply maps to a metric.
+	for _, tc := range []struct {
+		field  string
+		metric string
+		want   float64
+	}{
+		{field: "NTPHits", metric: "chrony_serverstats_ntp_packets_received_total", want: 1},
+		{field: "NKEHits", metric: "chrony_serverstats_nts_ke_connections_accepted_total", want: 2},
+		{field: "CMDHits", metric: "chrony_serverstats_command_packets_received_total", want: 3},
+		{field: "NTPDrops", metric: "chrony_serverstats_ntp_packets_dropped_total", want: 4},
+		{field: "NKEDrops", metric: "chrony_serverstats_nts_ke_connections_dropped_total", want: 5},
+		{field: "CMDDrops", metric: "chrony_serverstats_command_packets_dropped_total", want: 6},
+		{field: "LogDrops", metric: "chrony_serverstats_client_log_records_dropped_total", want: 7},
+		{field: "NTPAuthHits", metric: "chrony_serverstats_authenticated_ntp_packets_total", want: 8},
+		{field: "NTPInterleavedHits", metric: "chrony_serverstats_interleaved_ntp_packets_total", want: 9},
+		{field: "NTPTimestamps", metric: "chrony_serverstats_ntp_timestamps_held", want: 10},
+		{field: "NTPSpanSeconds", metric: "chrony_serverstats_ntp_timestamp_span_seconds", want: 11},
+		{field: "NTPDaemonRxtimestamps", metric: "chrony_serverstats_ntp_daemon_rx_timestamps_total", want: 12},
+		{field: "NTPDaemonTxtimestamps", metric: "chrony_serverstats_ntp_daemon_tx_timestamps_total", want: 13},
+		{field: "NTPKernelRxtimestamps", metric: "chrony_serverstats_ntp_kernel_rx_timestamps_total", want: 14},
+		{field: "NTPKernelTxtimestamps", metric: "chrony_serverstats_ntp_kernel_tx_timestamps_total", want: 15},
+		{field: "NTPHwRxTimestamps", metric: "chrony_serverstats_ntp_hw_rx_timestamps_total", want: 16},
+		{field: "NTPHwTxTimestamps", metric: "chrony_serverstats_ntp_hw_tx_timestamps_total", want: 1 << 40},
+	} {
+		t.Run(tc.field, func(t *testing.T) {
+			expectMetric(t, families, tc.want, tc.metric)
+		})
+	}
+}
+
+func TestServerstatsVersions(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		reply   chrony.ReplyType
+		stats   any
+		version float64
+		// present and absent are metrics only exported by some versions.
+		present []string
+		absent  []string
+	}{
+		{
+			name:    "serverstats",
+			reply:   chrony.RpyServerStats,
+			stats:   chrony.ServerStats{NTPHits: 1, CMDHits: 3, NTPDrops: 4, CMDDrops: 6, LogDrops: 7},
+			version: 1,
+			absent:  []string{"chrony_serverstats_nts_ke_connections_accepted_total", "chrony_serverstats_interleaved_ntp_packets_total", "chrony_serverstats_ntp_hw_tx_timestamps_total"},
+		},
+		{
+			name:    "serverstats2",
+			reply:   chrony.RpyServerStats2,
+			stats:   chrony.ServerStats2{NTPHits: 1, NKEHits: 2, CMDHits: 3, NTPDrops: 4, NKEDrops: 5, CMDDrops: 6, LogDrops: 7, NTPAuthHits: 8},
+			version: 2,
+			present: []string{"chrony_serverstats_nts_ke_connections_accepted_total", "chrony_serverstats_authenticated_ntp_packets_total"},
+			absent:  []string{"chrony_serverstats_interleaved_ntp_packets_total", "chrony_serverstats_ntp_hw_tx_timestamps_total"},
+		},
+		{
+			name:    "serverstats3",
+			reply:   chrony.RpyServerStats3,
+			stats:   chrony.ServerStats3{NTPHits: 1, NKEHits: 2, CMDHits: 3, NTPDrops: 4, NKEDrops: 5, CMDDrops: 6, LogDrops: 7, NTPAuthHits: 8, NTPInterleavedHits: 9, NTPTimestamps: 10, NTPSpanSeconds: 11},
+			version: 3,
+			present: []string{"chrony_serverstats_nts_ke_connections_accepted_total", "chrony_serverstats_interleaved_ntp_packets_total", "chrony_serverstats_ntp_timestamp_span_seconds"},
+			absent:  []string{"chrony_serverstats_ntp_hw_tx_timestamps_total"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			address := newFakeChrony(t, serverstatsHandler(tc.reply, tc.stats))
+			families := gatherMetrics(t, newTestExporter(address, ChronyCollectorConfig{CollectServerstats: true}))
+
+			expectMetric(t, families, tc.version, "chrony_serverstats_version")
+			// The fields common to all versions are widened to 64 bits.
+			expectMetric(t, families, 1, "chrony_serverstats_ntp_packets_received_total")
+			expectMetric(t, families, 3, "chrony_serverstats_command_packets_received_total")
+			expectMetric(t, families, 4, "chrony_serverstats_ntp_packets_dropped_total")
+			expectMetric(t, families, 6, "chrony_serverstats_command_packets_dropped_total")
+			expectMetric(t, families, 7, "chrony_serverstats_client_log_records_dropped_total")
+			for _, name := range tc.present {
+				if _, ok := metricValue(families, name); !ok {
+					t.Errorf("%s: missing", name)
+				}
+			}
+			for _, name := range tc.absent {
+				if _, ok := metricValue(families, name); ok {
+					t.Errorf("%s: want absent for %s", name, tc.name)
+				}
+			}
+		})
+	}
+}
+
+func TestServerstatsNotServing(t *testing.T) {
+	address := newFakeChrony(t, serverstatsHandler(chrony.RpyServerStats4, chrony.ServerStats4{CMDHits: 3}))
+	families := gatherMetrics(t, newTestExporter(address, ChronyCollectorConfig{CollectServerstats: true}))
+
+	expectMetric(t, families, 0, "chrony_is_server")
+}
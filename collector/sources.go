@@ -15,10 +15,14 @@ package collector
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math"
 	"math/bits"
+	"net"
+	"strconv"
+	"time"
 
 	"github.com/facebook/time/ntp/chrony"
 	"github.com/prometheus/client_golang/prometheus"
@@ -26,6 +30,10 @@ import (
 
 const (
 	sourcesSubsystem = "sources"
+
+	// sourcesSampleQualityMax caps the sample quality ratio for offsets
+	// that are close to zero.
+	sourcesSampleQualityMax = 100.0
 )
 
 var (
@@ -39,6 +47,26 @@ var (
 		prometheus.GaugeValue,
 	}
 
+	sourcesLastSampleTimestampMilliseconds = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcesSubsystem, "last_sample_timestamp_milliseconds"),
+			"Chrony sources last good sample timestamp in milliseconds, computed from the sample age at scrape time",
+			[]string{"source_address", "source_name"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	sourcesLastSampleTimestamp = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcesSubsystem, "last_sample_timestamp_seconds"),
+			"Chrony sources last good sample timestamp since unix epoch in seconds, computed from the sample age at scrape time",
+			[]string{"source_address", "source_name"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
 	sourcesLastReachRatio = typedDesc{
 		prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, sourcesSubsystem, "reachability_ratio"),
@@ -69,6 +97,13 @@ var (
 		prometheus.GaugeValue,
 	}
 
+	sourcesOffsetSummary = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, sourcesSubsystem, "offset_seconds"),
+		"Chrony sources last sample offsets within the sliding window in seconds",
+		[]string{"source_address", "source_name"},
+		nil,
+	)
+
 	sourcesLastSampleErr = typedDesc{
 		prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, sourcesSubsystem, "last_sample_error_margin_seconds"),
@@ -79,6 +114,26 @@ var (
 		prometheus.GaugeValue,
 	}
 
+	sourcesSampleQuality = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcesSubsystem, "sample_quality_ratio"),
+			"Chrony sources last sample margin of error divided by the absolute offset, clamped to 100",
+			[]string{"source_address", "source_name"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	sourcesReachabilityBit = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcesSubsystem, "reachability_bit"),
+			"Chrony sources reachability register bit, bit 0 is the most recent poll",
+			[]string{"source_address", "source_name", "bit"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
 	sourcesPollInterval = typedDesc{
 		prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, sourcesSubsystem, "polling_interval_seconds"),
@@ -89,6 +144,16 @@ var (
 		prometheus.GaugeValue,
 	}
 
+	sourcesNextPoll = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcesSubsystem, "next_poll_seconds"),
+			"Chrony sources estimated time until the next poll in seconds",
+			[]string{"source_address", "source_name"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
 	sourcesStateInfo = typedDesc{
 		prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, sourcesSubsystem, "state_info"),
@@ -99,6 +164,168 @@ var (
 		prometheus.GaugeValue,
 	}
 
+	sourcesStateInfoWithStratum = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcesSubsystem, "state_info"),
+			"Chrony sources state info",
+			[]string{"source_address", "source_name", "source_state", "source_mode", "stratum"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	sourcesState = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcesSubsystem, "state"),
+			"Chrony sources state code, 0 sync, 1 unreach, 2 falseticker, 3 jittery, 4 candidate, 5 outlier",
+			[]string{"source_address", "source_name"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	sourcesByMode = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcesSubsystem, "by_mode"),
+			"Chrony number of sources in each mode",
+			[]string{"source_mode"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	sourcesSelectableCount = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "selectable_sources_count"),
+			"Chrony number of sources considered selectable (sync, candidate or outlier state)",
+			nil,
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	sourcesCombinedCount = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "combined_sources_count"),
+			"Chrony number of sources combined into the clock estimate (sync or candidate state)",
+			nil,
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	sourcesOptions = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcesSubsystem, "options"),
+			"Chrony sources configured selection options",
+			[]string{"source_address", "source_name", "noselect", "prefer", "trust", "require"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	sourcesDispersion = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcesSubsystem, "dispersion_seconds"),
+			"Chrony sources peer dispersion from the last NTP measurement in seconds",
+			[]string{"source_address", "source_name"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	sourcesJitterAsymmetry = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcesSubsystem, "jitter_asymmetry"),
+			"Chrony sources estimated asymmetry of the network jitter, from -0.5 to 0.5",
+			[]string{"source_address", "source_name"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	ntpdataAvailable = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "ntpdata", "available"),
+			"Whether the ntpdata requests of the sources collector are answered, they require a unix socket connection",
+			nil,
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	// The root distance is the estimated error bound of the source to the
+	// root, half the root delay plus the root dispersion.
+	sourcesRootDistance = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcesSubsystem, "root_distance_seconds"),
+			"Chrony sources root distance (root delay / 2 + root dispersion) from the last NTP measurement in seconds",
+			[]string{"source_address", "source_name"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	sourcesOnlineCount = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcesSubsystem, "online_count"),
+			"Chrony number of sources that were reachable in at least one of the last 8 polls",
+			nil,
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	sourcesMaxAbsOffset = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcesSubsystem, "max_abs_last_sample_offset_seconds"),
+			"Chrony largest absolute last sample offset of all sources in seconds",
+			nil,
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	sourcesStaleCount = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcesSubsystem, "stale_count"),
+			"Chrony number of sources whose last sample is older than the stale threshold",
+			nil,
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	sourcesOffsetSpread = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcesSubsystem, "offset_spread_seconds"),
+			"Chrony difference between the largest and smallest last sample offset of the sources in seconds",
+			nil,
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	sourcesMinReachRatio = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcesSubsystem, "min_reachability_ratio"),
+			"Chrony lowest ratio of packet reachability of all sources",
+			nil,
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	sourcesSelectedStratum = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "selected_source_stratum"),
+			"Chrony stratum of the source selected by tracking",
+			nil,
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
 	sourcesStratum = typedDesc{
 		prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, sourcesSubsystem, "stratum"),
@@ -110,54 +337,374 @@ var (
 	}
 )
 
-func (e Exporter) getSourcesMetrics(logger *slog.Logger, ch chan<- prometheus.Metric, client chrony.Client) error {
-	packet, err := client.Communicate(chrony.NewSourcesPacket())
+// sourceIncluded returns true when the source address matches the
+// configured include list, or no include list is configured.
+func (e Exporter) sourceIncluded(address net.IP) bool {
+	if len(e.sourcesIncludeAddresses) == 0 {
+		return true
+	}
+	for _, network := range e.sourcesIncludeAddresses {
+		if network.Contains(address) {
+			return true
+		}
+	}
+	return false
+}
+
+// sampleQualityRatio returns the margin of error relative to the absolute
+// offset, |err / offset|, clamped to [0, sourcesSampleQualityMax]. A zero
+// offset with a non-zero error returns the maximum.
+func sampleQualityRatio(offset, errMargin float64) float64 {
+	if errMargin == 0 {
+		return 0
+	}
+	if offset == 0 {
+		return sourcesSampleQualityMax
+	}
+	return math.Min(math.Abs(errMargin/offset), sourcesSampleQualityMax)
+}
+
+// parseSourceDataPacket normalizes the 'sourcedata' reply versions. The
+// chrony library currently only implements a single version.
+func parseSourceDataPacket(p chrony.ResponsePacket) (chrony.ReplySourceData, error) {
+	switch sourceData := p.(type) {
+	case *chrony.ReplySourceData:
+		return *sourceData, nil
+	default:
+		return chrony.ReplySourceData{}, fmt.Errorf("Got wrong 'sourcedata' response: %q", p)
+	}
+}
+
+// parseNTPDataPacket normalizes the 'ntpdata' reply versions.
+func parseNTPDataPacket(p chrony.ResponsePacket) (chrony.NTPData, error) {
+	switch ntpData := p.(type) {
+	case *chrony.ReplyNTPData:
+		return ntpData.NTPData, nil
+	case *chrony.ReplyNTPData2:
+		return ntpData.NTPData, nil
+	default:
+		return chrony.NTPData{}, fmt.Errorf("Got wrong 'ntpdata' response: %q", p)
+	}
+}
+
+// getSourceNTPData requests the 'ntpdata' of an NTP source. It is only
+// available over the unix socket.
+func (e Exporter) getSourceNTPData(client *chrony.Client, address net.IP) (chrony.NTPData, error) {
+	packet, err := e.communicate(client, "ntpdata", chrony.NewNTPDataPacket(address))
+	if err != nil {
+		return chrony.NTPData{}, err
+	}
+	return parseNTPDataPacket(packet)
+}
+
+// ntpdataRequested returns true when the ntpdata of the source is requested.
+// Only the selected source is requested with ntpdataOnlySelected, unless
+// tracking didn't select one.
+func (e Exporter) ntpdataRequested(address net.IP) bool {
+	if !e.ntpdataOnlySelected || e.selectedSource == nil || e.selectedSource.IsUnspecified() {
+		return true
+	}
+	return address.Equal(e.selectedSource)
+}
+
+// sourceName returns the name of an NTP source. When enabled, the name the
+// source is configured with in chrony takes precedence over DNS lookups, but
+// not over the static name map. Configured names are only requested with a
+// client.
+func (e Exporter) sourceName(logger *slog.Logger, client *chrony.Client, address net.IP) string {
+	if _, ok := e.nameMap[address.String()]; ok || !e.sourcesUseConfiguredNames || client == nil {
+		return e.dnsLookup(logger, address)
+	}
+	packet, err := e.communicate(client, "ntpsourcename", chrony.NewNTPSourceNamePacket(address))
+	if err != nil {
+		logger.Debug("Couldn't get source name", "source_address", address.String(), "err", err)
+		return e.dnsLookup(logger, address)
+	}
+	sourceName, ok := packet.(*chrony.ReplyNTPSourceName)
+	if !ok {
+		logger.Debug("Got wrong 'ntpsourcename' response", "source_address", address.String(), "packet", packet)
+		return e.dnsLookup(logger, address)
+	}
+	if sourceName.Name == "" {
+		return e.dnsLookup(logger, address)
+	}
+	return sourceName.Name
+}
+
+// getSourcesMetrics exports the sources metrics of the sourcedata requested
+// at scrapeTime.
+func (e Exporter) getSourcesMetrics(logger *slog.Logger, ch chan<- prometheus.Metric, client chrony.Client, scrapeTime time.Time, results []chrony.ReplySourceData) {
+	ntpClient := &client
+	if e.sourcesWithNTPData && e.ntpdataAddress != "" {
+		var cleanup func()
+		ntpClient, cleanup = e.dialNTPData(logger)
+		defer cleanup()
+	}
+
+	e.exportSourcesMetrics(logger, ch, &client, ntpClient, scrapeTime, results)
+}
+
+// getSourceData requests the sourcedata of all sources. The enumeration
+// ends early when sources were removed since the 'sources' request, for
+// example by a reconfiguration, returning the sources collected so far.
+// Sources chrony replies to with an error status or that can't be parsed are
+// skipped.
+func (e Exporter) getSourceData(logger *slog.Logger, client *chrony.Client) ([]chrony.ReplySourceData, error) {
+	packet, err := e.communicate(client, "sources", chrony.NewSourcesPacket())
 	if err != nil {
-		return err
+		return nil, err
 	}
 	logger.Debug("Got 'sources' response", "sources_packet", packet.GetStatus())
 
 	sources, ok := packet.(*chrony.ReplySources)
 	if !ok {
-		return fmt.Errorf("Got wrong 'sources' response: %q", packet)
+		return nil, fmt.Errorf("Got wrong 'sources' response: %q", packet)
 	}
 
-	results := make([]chrony.ReplySourceData, sources.NSources)
+	fetch := func(i int) (chrony.ResponsePacket, error) {
+		return e.communicate(client, "sourcedata", chrony.NewSourceDataPacket(int32(i)))
+	}
+	if e.sourcesBatch {
+		requests := make([]chrony.RequestPacket, sources.NSources)
+		for i := range requests {
+			requests[i] = chrony.NewSourceDataPacket(int32(i))
+		}
+		replies, errs, err := e.communicatePipelined(client, "sourcedata", requests)
+		if err != nil {
+			return nil, err
+		}
+		fetch = func(i int) (chrony.ResponsePacket, error) {
+			return replies[i], errs[i]
+		}
+	} else if e.sourcesWorkers > 1 && e.conn == nil {
+		replies, errs := e.fetchSourcesParallel(logger, client, int(sources.NSources))
+		fetch = func(i int) (chrony.ResponsePacket, error) {
+			return replies[i], errs[i]
+		}
+	}
 
+	results := make([]chrony.ReplySourceData, 0, sources.NSources)
 	for i := 0; i < int(sources.NSources); i++ {
-		logger.Debug("Fetching source", "source", i)
-		packet, err = client.Communicate(chrony.NewSourceDataPacket(int32(i)))
-		if err != nil {
-			return fmt.Errorf("Failed to get sourcedata response: %d", i)
+		logger.Debug("Fetching source", "index", i)
+		packet, err := fetch(i)
+		var statusErr *statusError
+		switch {
+		case hasStatus(err, statusNoSuchSource):
+			logger.Debug("Sources changed during enumeration", "sources", sources.NSources, "collected", i)
+			e.sourcesEnumerationMismatch.Inc()
+			return results, nil
+		case errors.Is(err, errCommandUnsupported):
+			return nil, err
+		case errors.As(err, &statusErr):
+			logger.Debug("Couldn't get sourcedata", "index", i, "err", err)
+			continue
+		case err != nil:
+			return nil, fmt.Errorf("Failed to get sourcedata response %d: %w", i, err)
 		}
-		sourceData, ok := packet.(*chrony.ReplySourceData)
-		if !ok {
-			return fmt.Errorf("Got wrong 'sourcedata' response: %q", packet)
+		sourceData, err := parseSourceDataPacket(packet)
+		if err != nil {
+			// Skip sources that can't be parsed rather than failing all sources.
+			logger.Debug("Unable to parse 'sourcedata' packet", "index", i, "err", err)
+			continue
 		}
-		results[i] = *sourceData
+		results = append(results, sourceData)
+	}
+	return results, nil
+}
+
+// dialNTPData connects to the separate ntpdata address. The returned client
+// is nil when the connection fails.
+func (e Exporter) dialNTPData(logger *slog.Logger) (*chrony.Client, func()) {
+	ntpdata := e
+	ntpdata.address = e.ntpdataAddress
+	ntpdata.conn = nil
+	dialStart := time.Now()
+	conn, err, cleanup := ntpdata.dial()
+	if e.timings != nil {
+		e.timings.dial += time.Since(dialStart)
+	}
+	if err != nil {
+		logger.Debug("Couldn't connect to chrony for ntpdata", "address", e.ntpdataAddress, "err", err)
+		return nil, cleanup
+	}
+	return &chrony.Client{Sequence: initialSequence, Connection: conn}, cleanup
+}
+
+// exportSourcesMetrics exports the sources metrics. The configured names and
+// selection options are only requested with a client, and the ntpdata with
+// an ntpdata client.
+func (e Exporter) exportSourcesMetrics(logger *slog.Logger, ch chan<- prometheus.Metric, client, ntpClient *chrony.Client, scrapeTime time.Time, results []chrony.ReplySourceData) {
+
+	// Count every known mode so that absent modes report 0.
+	modeCounts := make(map[string]float64, len(chrony.ModeTypeDesc))
+	for _, mode := range chrony.ModeTypeDesc {
+		modeCounts[mode] = 0
 	}
 
+	var selectable, combined, online, stale float64
+	// The worst offset and reachability are only exported when at least one
+	// source is included.
+	var included int
+	var maxAbsOffset float64
+	minReachRatio := 1.0
+	// The offset spread is only exported when at least one source is
+	// selectable, or included with sourcesOffsetSpreadAll.
+	var spreadSources int
+	minOffset, maxOffset := math.Inf(1), math.Inf(-1)
+
+	// The sources seen in this scrape, the others are evicted from the offset
+	// window.
+	seen := make(map[string]bool, len(results))
+
+	var ntpdataAnswered, ntpdataFailed bool
+
 	for _, r := range results {
-		sourceAddress := r.IPAddr.String()
-		sourceName := e.dnsLookup(logger, r.IPAddr)
+		if e.selectedSource != nil && r.IPAddr.Equal(e.selectedSource) {
+			ch <- sourcesSelectedStratum.mustNewConstMetric(e.metricOpts, float64(r.Stratum))
+		}
+		if !e.sourceIncluded(r.IPAddr) {
+			continue
+		}
+		if e.sourcesSkipUnknownState && int(r.State) >= len(chrony.SourceStateDesc) {
+			logger.Debug("Skipping source in unknown state", "source_address", r.IPAddr.String(), "source_state", r.State.String())
+			continue
+		}
 
-		if r.Mode == chrony.SourceModeRef && r.IPAddr.To4() != nil {
-			sourceName = chrony.RefidToString(binary.BigEndian.Uint32(r.IPAddr))
+		modeCounts[r.Mode.String()]++
+
+		isSelectable := false
+		switch r.State {
+		case chrony.SourceStateSync, chrony.SourceStateCandidate:
+			selectable++
+			combined++
+			isSelectable = true
+		case chrony.SourceStateOutlier:
+			selectable++
+			isSelectable = true
+		}
+		if isSelectable || e.sourcesOffsetSpreadAll {
+			spreadSources++
+			minOffset = math.Min(minOffset, r.LatestMeas)
+			maxOffset = math.Max(maxOffset, r.LatestMeas)
 		}
 
 		// Compute the reachability from the Reachability bits.
 		lastReachRatio := float64(bits.OnesCount8(uint8(r.Reachability))) / 8.0
 		lastReachSuccess := uint8(r.Reachability) & 1
 
-		ch <- sourcesLastRx.mustNewConstMetric(float64(r.SinceSample), sourceAddress, sourceName)
-		ch <- sourcesLastReachRatio.mustNewConstMetric(lastReachRatio, sourceAddress, sourceName)
-		ch <- sourcesLastReachSuccess.mustNewConstMetric(float64(lastReachSuccess), sourceAddress, sourceName)
-		ch <- sourcesLastSample.mustNewConstMetric(r.LatestMeas, sourceAddress, sourceName)
-		ch <- sourcesLastSampleErr.mustNewConstMetric(r.LatestMeasErr, sourceAddress, sourceName)
-		ch <- sourcesPollInterval.mustNewConstMetric(math.Pow(2, float64(r.Poll)), sourceAddress, sourceName)
-		ch <- sourcesStateInfo.mustNewConstMetric(1.0, sourceAddress, sourceName, r.State.String(), r.Mode.String())
-		ch <- sourcesStratum.mustNewConstMetric(float64(r.Stratum), sourceAddress, sourceName)
+		included++
+		if uint8(r.Reachability) != 0 {
+			online++
+		}
+		staleThreshold := e.sourcesStaleThreshold.Seconds()
+		if staleThreshold == 0 {
+			staleThreshold = 2 * math.Pow(2, float64(r.Poll))
+		}
+		if float64(r.SinceSample) > staleThreshold {
+			stale++
+		}
+		maxAbsOffset = math.Max(maxAbsOffset, math.Abs(r.LatestMeas))
+		minReachRatio = math.Min(minReachRatio, lastReachRatio)
+
+		if e.sourcesAggregateOnly {
+			continue
+		}
+
+		sourceAddress := r.IPAddr.String()
+		var sourceName string
+		if r.Mode == chrony.SourceModeRef && r.IPAddr.To4() != nil {
+			sourceName = chrony.RefidToString(binary.BigEndian.Uint32(r.IPAddr))
+		} else {
+			sourceName = e.sourceName(logger, client, r.IPAddr)
+		}
+
+		ch <- sourcesLastRx.mustNewConstMetric(e.metricOpts, float64(r.SinceSample), sourceAddress, sourceName)
+		lastSample := scrapeTime.Add(-time.Duration(r.SinceSample) * time.Second)
+		if e.sourcesLastSampleTimestamp {
+			ch <- sourcesLastSampleTimestamp.mustNewConstMetric(e.metricOpts, float64(lastSample.Unix()), sourceAddress, sourceName)
+		}
+		if e.timestampsMilliseconds {
+			ch <- sourcesLastSampleTimestampMilliseconds.mustNewConstMetric(e.metricOpts, float64(lastSample.UnixMilli()), sourceAddress, sourceName)
+		}
+		ch <- sourcesLastReachRatio.mustNewConstMetric(e.metricOpts, lastReachRatio, sourceAddress, sourceName)
+		ch <- sourcesLastReachSuccess.mustNewConstMetric(e.metricOpts, float64(lastReachSuccess), sourceAddress, sourceName)
+		if e.sourcesReachabilityBits {
+			for bit := 0; bit < 8; bit++ {
+				ch <- sourcesReachabilityBit.mustNewConstMetric(e.metricOpts, float64((r.Reachability>>bit)&1), sourceAddress, sourceName, strconv.Itoa(bit))
+			}
+		}
+		ch <- sourcesLastSample.mustNewConstMetric(e.metricOpts, r.LatestMeas, sourceAddress, sourceName)
+		if e.sourceOffsets != nil {
+			seen[sourceAddress] = true
+			count, sum, quantiles := e.sourceOffsets.observe(sourceAddress, lastSample, r.LatestMeas)
+			ch <- prometheus.MustNewConstSummary(sourcesOffsetSummary, count, sum, quantiles, sourceAddress, sourceName)
+		}
+		ch <- sourcesLastSampleErr.mustNewConstMetric(e.metricOpts, r.LatestMeasErr, sourceAddress, sourceName)
+		ch <- sourcesSampleQuality.mustNewConstMetric(e.metricOpts, sampleQualityRatio(r.LatestMeas, r.LatestMeasErr), sourceAddress, sourceName)
+		pollInterval := math.Pow(2, float64(r.Poll))
+		ch <- sourcesPollInterval.mustNewConstMetric(e.metricOpts, pollInterval, sourceAddress, sourceName)
+		// The next poll is expected one polling interval after the last
+		// sample. A source that is overdue stays at zero.
+		ch <- sourcesNextPoll.mustNewConstMetric(e.metricOpts, max(0, pollInterval-float64(r.SinceSample)), sourceAddress, sourceName)
+		if e.sourcesStratumLabel {
+			ch <- sourcesStateInfoWithStratum.mustNewConstMetric(e.metricOpts, 1.0, sourceAddress, sourceName, r.State.String(), r.Mode.String(), strconv.Itoa(int(r.Stratum)))
+		} else {
+			ch <- sourcesStateInfo.mustNewConstMetric(e.metricOpts, 1.0, sourceAddress, sourceName, r.State.String(), r.Mode.String())
+		}
+		if e.sourcesStateCodes {
+			ch <- sourcesState.mustNewConstMetric(e.metricOpts, float64(r.State), sourceAddress, sourceName)
+		}
+		ch <- sourcesStratum.mustNewConstMetric(e.metricOpts, float64(r.Stratum), sourceAddress, sourceName)
+		// Reference clocks have no ntpdata. The reply is requested once per
+		// source and shared by all ntpdata metrics.
+		if e.sourcesWithNTPData && ntpClient != nil && r.Mode != chrony.SourceModeRef && e.ntpdataRequested(r.IPAddr) {
+			ntpData, err := e.getSourceNTPData(ntpClient, r.IPAddr)
+			if err != nil {
+				logger.Debug("Couldn't get source ntpdata", "source_address", sourceAddress, "err", err)
+				ntpdataFailed = true
+			} else {
+				ntpdataAnswered = true
+				ch <- sourcesDispersion.mustNewConstMetric(e.metricOpts, ntpData.PeerDispersion, sourceAddress, sourceName)
+				ch <- sourcesRootDistance.mustNewConstMetric(e.metricOpts, ntpData.RootDelay/2+ntpData.RootDispersion, sourceAddress, sourceName)
+				ch <- sourcesJitterAsymmetry.mustNewConstMetric(e.metricOpts, ntpData.JitterAsymmetry, sourceAddress, sourceName)
+			}
+		}
+		if client == nil {
+			continue
+		}
+		ch <- sourcesOptions.mustNewConstMetric(e.metricOpts, 1.0, sourceAddress, sourceName,
+			strconv.FormatBool(r.Flags&chrony.FlagSDOptionNoSelect != 0),
+			strconv.FormatBool(r.Flags&chrony.FlagSDOptionPrefer != 0),
+			strconv.FormatBool(r.Flags&chrony.FlagSDOptionTrust != 0),
+			strconv.FormatBool(r.Flags&chrony.FlagSDOptionRequire != 0),
+		)
 	}
 
-	return nil
+	if e.sourceOffsets != nil {
+		e.sourceOffsets.retain(seen)
+	}
+	if e.sourcesWithNTPData {
+		// Without NTP sources there is nothing to request, so ntpdata is
+		// assumed available when there is an ntpdata connection.
+		var available float64
+		if ntpdataAnswered || (ntpClient != nil && !ntpdataFailed) {
+			available = 1
+		}
+		ch <- ntpdataAvailable.mustNewConstMetric(e.metricOpts, available)
+	}
+
+	for mode, count := range modeCounts {
+		ch <- sourcesByMode.mustNewConstMetric(e.metricOpts, count, mode)
+	}
+	ch <- sourcesSelectableCount.mustNewConstMetric(e.metricOpts, selectable)
+	ch <- sourcesCombinedCount.mustNewConstMetric(e.metricOpts, combined)
+	ch <- sourcesOnlineCount.mustNewConstMetric(e.metricOpts, online)
+	ch <- sourcesStaleCount.mustNewConstMetric(e.metricOpts, stale)
+	if included > 0 {
+		ch <- sourcesMaxAbsOffset.mustNewConstMetric(e.metricOpts, maxAbsOffset)
+		ch <- sourcesMinReachRatio.mustNewConstMetric(e.metricOpts, minReachRatio)
+	}
+	if spreadSources > 0 {
+		ch <- sourcesOffsetSpread.mustNewConstMetric(e.metricOpts, maxOffset-minOffset)
+	}
 }
@@ -0,0 +1,215 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/facebook/time/ntp/chrony"
+)
+
+func TestSourcesRemovedDuringEnumeration(t *testing.T) {
+	sources := newTestSources(3)
+	handle := sourcesHandler(sources)
+	// The third source is removed after the 'sources' reply.
+	address := newFakeChrony(t, func(req fakeRequest) []byte {
+		if req.command == fakeReqSourceData && req.index == 2 {
+			return fakeStatus(req, statusNoSuchSource)
+		}
+		return handle(req)
+	})
+	e := newTestExporter(address, ChronyCollectorConfig{CollectSources: true})
+	families := gatherMetrics(t, e)
+
+	expectMetric(t, families, 1, "chrony_up")
+	expectMetric(t, families, 1, "chrony_collector_up", "collector", "sources")
+	expectMetric(t, families, 1, "chrony_sources_enumeration_mismatch_total")
+	if n := metricCount(families, "chrony_sources_stratum"); n != 2 {
+		t.Errorf("chrony_sources_stratum: got %d sources, want 2", n)
+	}
+}
+
+func TestSourcesFailedSourceData(t *testing.T) {
+	handle := sourcesHandler(newTestSources(2))
+	address := newFakeChrony(t, func(req fakeRequest) []byte {
+		if req.command == fakeReqSourceData && req.index == 1 {
+			return fakeStatus(req, 1)
+		}
+		return handle(req)
+	})
+	e := newTestExporter(address, ChronyCollectorConfig{CollectSources: true})
+	families := gatherMetrics(t, e)
+
+	// The failed source is skipped.
+	expectMetric(t, families, 1, "chrony_up")
+	expectMetric(t, families, 1, "chrony_collector_up", "collector", "sources")
+	expectMetric(t, families, 0, "chrony_sources_enumeration_mismatch_total")
+	if n := metricCount(families, "chrony_sources_stratum"); n != 1 {
+		t.Errorf("chrony_sources_stratum: got %d sources, want 1", n)
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	req := fakeRequest{command: fakeReqSourceData, sequence: 1}
+	_, err := decodeReply(chrony.NewSourceDataPacket(0), fakeStatus(req, statusNoSuchSource))
+	wrapped := fmt.Errorf("Failed to get sourcedata response %d: %w", 0, err)
+
+	if !hasStatus(wrapped, statusNoSuchSource) {
+		t.Errorf("hasStatus(%q, NOSUCHSOURCE): got false, want true", wrapped)
+	}
+	if hasStatus(wrapped, statusInvalid) {
+		t.Errorf("hasStatus(%q, INVALID): got true, want false", wrapped)
+	}
+	if commandUnsupported(wrapped) {
+		t.Errorf("commandUnsupported(%q): got true, want false", wrapped)
+	}
+	var statusErr *statusError
+	if !errors.As(wrapped, &statusErr) || statusErr.status != statusNoSuchSource {
+		t.Errorf("errors.As(%q): want NOSUCHSOURCE status error", wrapped)
+	}
+
+	_, err = decodeReply(chrony.NewServerStatsPacket(), fakeStatus(req, statusUnauth))
+	if !commandUnsupported(err) {
+		t.Errorf("commandUnsupported(%q): got false, want true", err)
+	}
+}
+
+func TestSourcesMinReachability(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		reachability []uint16
+		want         float64
+	}{
+		{name: "all reachable", reachability: []uint16{0377, 0377}, want: 1},
+		{name: "half reachable", reachability: []uint16{0377, 0017}, want: 0.5},
+		{name: "single reply", reachability: []uint16{0001, 0377, 0017}, want: 0.125},
+		{name: "unreachable", reachability: []uint16{0377, 0}, want: 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sources := newTestSources(len(tc.reachability))
+			for i, reach := range tc.reachability {
+				sources[i].Reachability = reach
+			}
+			address := newFakeChrony(t, sourcesHandler(sources))
+			for _, aggregateOnly := range []bool{false, true} {
+				e := newTestExporter(address, ChronyCollectorConfig{CollectSources: true, SourcesAggregateOnly: aggregateOnly})
+				families := gatherMetrics(t, e)
+
+				expectMetric(t, families, tc.want, "chrony_sources_min_reachability_ratio")
+			}
+		})
+	}
+}
+
+// newFakePTRResolver returns a resolver answering every reverse lookup with
+// name, and sends the question names it receives to questions.
+func newFakePTRResolver(name string, questions chan<- string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go serveFakePTR(server, name, questions)
+			return client, nil
+		},
+	}
+}
+
+// serveFakePTR answers DNS queries over a stream connection with a PTR
+// record.
+func serveFakePTR(conn net.Conn, name string, questions chan<- string) {
+	defer conn.Close()
+	for {
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return
+		}
+		query := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, query); err != nil || len(query) < 12 {
+			return
+		}
+		// The question name is a sequence of labels after the header.
+		var labels []string
+		end := 12
+		for end < len(query) && query[end] != 0 {
+			n := int(query[end])
+			if end+1+n > len(query) {
+				return
+			}
+			labels = append(labels, string(query[end+1:end+1+n]))
+			end += 1 + n
+		}
+		end += 5 // The terminating label, type and class.
+		if end > len(query) {
+			return
+		}
+		questions <- strings.Join(labels, ".") + "."
+
+		var rdata []byte
+		for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+			rdata = append(append(rdata, byte(len(label))), label...)
+		}
+		rdata = append(rdata, 0)
+		reply := binary.BigEndian.AppendUint16(nil, binary.BigEndian.Uint16(query))
+		reply = append(reply, 0x81, 0x80, 0, 1, 0, 1, 0, 0, 0, 0)
+		reply = append(reply, query[12:end]...)
+		// The answer refers to the question name, PTR, IN, a TTL of 60s.
+		reply = append(reply, 0xc0, 0x0c, 0, 12, 0, 1, 0, 0, 0, 60)
+		reply = binary.BigEndian.AppendUint16(reply, uint16(len(rdata)))
+		reply = append(reply, rdata...)
+		if _, err := conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(reply))), reply...)); err != nil {
+			return
+		}
+	}
+}
+
+func TestSourcesLinkLocalAddress(t *testing.T) {
+	// chrony reports a link-local source such as fe80::1%eth0 without the
+	// zone, the command protocol has no field for it.
+	sources := newTestSources(1)
+	sources[0].IPAddr = newFakeIPAddr("fe80::1")
+	address := newFakeChrony(t, sourcesHandler(sources))
+
+	t.Run("name map", func(t *testing.T) {
+		e := newTestExporter(address, ChronyCollectorConfig{CollectSources: true, NameMap: map[string]string{"fe80::1": "peer"}})
+		families := gatherMetrics(t, e)
+
+		expectMetric(t, families, 2, "chrony_sources_stratum", "source_address", "fe80::1", "source_name", "peer")
+	})
+
+	t.Run("dns", func(t *testing.T) {
+		questions := make(chan string, 10)
+		e := newTestExporter(address, ChronyCollectorConfig{CollectSources: true, DNSLookups: true})
+		e.resolver = newFakePTRResolver("peer.example.", questions)
+		families := gatherMetrics(t, e)
+
+		expectMetric(t, families, 2, "chrony_sources_stratum", "source_address", "fe80::1", "source_name", "peer.example")
+		// The reverse lookup is of fe80::1.
+		want := "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.e.f.ip6.arpa."
+		select {
+		case got := <-questions:
+			if got != want {
+				t.Errorf("PTR question: got %s, want %s", got, want)
+			}
+		default:
+			t.Error("no PTR question received")
+		}
+	})
+}
@@ -0,0 +1,177 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+
+	"github.com/facebook/time/ntp/chrony"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	sourcestatsSubsystem = "sourcestats"
+)
+
+var (
+	sourcestatsSamples = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcestatsSubsystem, "samples"),
+			"Chrony sourcestats number of sample points currently retained",
+			[]string{"source_address", "source_name"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	sourcestatsRuns = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcestatsSubsystem, "runs"),
+			"Chrony sourcestats number of runs of residuals with the same sign following the last regression",
+			[]string{"source_address", "source_name"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	sourcestatsSpan = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcestatsSubsystem, "span_seconds"),
+			"Chrony sourcestats interval between the oldest and newest samples in seconds",
+			[]string{"source_address", "source_name"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	sourcestatsStdDev = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcestatsSubsystem, "offset_std_dev_seconds"),
+			"Chrony sourcestats estimated sample offset standard deviation in seconds",
+			[]string{"source_address", "source_name"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	sourcestatsResidualFrequency = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcestatsSubsystem, "residual_frequency_ppms"),
+			"Chrony sourcestats estimated residual frequency of the source, in PPMs",
+			[]string{"source_address", "source_name"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	sourcestatsSkew = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcestatsSubsystem, "skew_ppms"),
+			"Chrony sourcestats estimated error bound on the residual frequency, in PPMs",
+			[]string{"source_address", "source_name"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	sourcestatsOffset = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcestatsSubsystem, "offset_seconds"),
+			"Chrony sourcestats estimated offset of the source in seconds, positive when the local clock is fast relative to the source",
+			[]string{"source_address", "source_name"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	sourcestatsOffsetErr = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, sourcestatsSubsystem, "offset_error_seconds"),
+			"Chrony sourcestats estimated offset error in seconds",
+			[]string{"source_address", "source_name"},
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+)
+
+// sourcestatsAddress returns the source address of a sourcestats reply.
+// Reference clocks have no address, so the refid is encoded as an IPv4
+// address to match the sources collector.
+func sourcestatsAddress(stats chrony.SourceStats) net.IP {
+	if stats.IPAddr.IsUnspecified() {
+		refIP := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(refIP, stats.RefID)
+		return refIP
+	}
+	return stats.IPAddr
+}
+
+func (e Exporter) getSourcestatsMetrics(logger *slog.Logger, ch chan<- prometheus.Metric, client chrony.Client) error {
+	packet, err := e.communicate(&client, "sources", chrony.NewSourcesPacket())
+	if err != nil {
+		return err
+	}
+	logger.Debug("Got 'sources' response", "sources_packet", packet.GetStatus())
+
+	sources, ok := packet.(*chrony.ReplySources)
+	if !ok {
+		return fmt.Errorf("Got wrong 'sources' response: %q", packet)
+	}
+
+	for i := 0; i < int(sources.NSources); i++ {
+		logger.Debug("Fetching sourcestats", "index", i)
+		packet, err = e.communicate(&client, "sourcestats", chrony.NewSourceStatsPacket(int32(i)))
+		switch {
+		case hasStatus(err, statusNoSuchSource):
+			logger.Debug("Sources changed during enumeration", "sources", sources.NSources, "collected", i)
+			e.sourcesEnumerationMismatch.Inc()
+			return nil
+		case err != nil:
+			return fmt.Errorf("Failed to get sourcestats response %d: %w", i, err)
+		}
+		stats, ok := packet.(*chrony.ReplySourceStats)
+		if !ok {
+			return fmt.Errorf("Got wrong 'sourcestats' response: %q", packet)
+		}
+
+		address := sourcestatsAddress(stats.SourceStats)
+		if !e.sourceIncluded(address) {
+			continue
+		}
+
+		sourceAddress := address.String()
+		sourceName := chrony.RefidToString(stats.RefID)
+		if !stats.IPAddr.IsUnspecified() {
+			sourceName = e.dnsLookup(logger, address)
+		}
+
+		// The offset and residual frequency are exported with chronyd's sign
+		// convention, matching `chronyc sourcestats`: the offset is positive
+		// when the local clock is fast relative to the source.
+		ch <- sourcestatsSamples.mustNewConstMetric(e.metricOpts, float64(stats.NSamples), sourceAddress, sourceName)
+		ch <- sourcestatsRuns.mustNewConstMetric(e.metricOpts, float64(stats.NRuns), sourceAddress, sourceName)
+		ch <- sourcestatsSpan.mustNewConstMetric(e.metricOpts, float64(stats.SpanSeconds), sourceAddress, sourceName)
+		ch <- sourcestatsStdDev.mustNewConstMetric(e.metricOpts, stats.StandardDeviation, sourceAddress, sourceName)
+		ch <- sourcestatsResidualFrequency.mustNewConstMetric(e.metricOpts, stats.ResidFreqPPM, sourceAddress, sourceName)
+		ch <- sourcestatsSkew.mustNewConstMetric(e.metricOpts, stats.SkewPPM, sourceAddress, sourceName)
+		ch <- sourcestatsOffset.mustNewConstMetric(e.metricOpts, stats.EstimatedOffset, sourceAddress, sourceName)
+		ch <- sourcestatsOffsetErr.mustNewConstMetric(e.metricOpts, stats.EstimatedOffsetErr, sourceAddress, sourceName)
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/facebook/time/ntp/chrony"
+)
+
+// sourcestatsHandler replies to the sources and sourcestats requests with
+// the stats, and to other requests as invalid.
+func sourcestatsHandler(stats []fakeSourceStats) fakeHandler {
+	return func(req fakeRequest) []byte {
+		switch req.command {
+		case fakeReqSources:
+			return fakeReply(req, chrony.RpyNSources, statusSuccess, uint32(len(stats)))
+		case fakeReqSourceStats:
+			if req.index < 0 || int(req.index) >= len(stats) {
+				return fakeStatus(req, statusNoSuchSource)
+			}
+			return fakeReply(req, chrony.RpySourceStats, statusSuccess, stats[req.index])
+		}
+		return fakeStatus(req, statusInvalid)
+	}
+}
+
+func TestSourcestatsOffsetSign(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		offset float64
+	}{
+		// chronyd reports the offset positive when the local clock is fast
+		// relative to the source, so a source behind the local clock has a
+		// positive offset.
+		{name: "local clock fast", offset: 0.25},
+		{name: "local clock slow", offset: -0.25},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			address := newFakeChrony(t, sourcestatsHandler([]fakeSourceStats{{
+				RefID:              0xc0000201,
+				IPAddr:             newFakeIPAddr("192.0.2.1"),
+				NSamples:           8,
+				NRuns:              5,
+				SpanSeconds:        512,
+				StandardDeviation:  toChronyFloat(0.0005),
+				ResidFreqPPM:       toChronyFloat(-0.125),
+				SkewPPM:            toChronyFloat(0.5),
+				EstimatedOffset:    toChronyFloat(tc.offset),
+				EstimatedOffsetErr: toChronyFloat(0.001),
+			}}))
+			e := newTestExporter(address, ChronyCollectorConfig{CollectSourcestats: true})
+			families := gatherMetrics(t, e)
+
+			labels := []string{"source_address", "192.0.2.1", "source_name", "192.0.2.1"}
+			expectMetric(t, families, 1, "chrony_collector_up", "collector", "sourcestats")
+			expectMetric(t, families, chronyFloatValue(toChronyFloat(tc.offset)), "chrony_sourcestats_offset_seconds", labels...)
+			expectMetric(t, families, chronyFloatValue(toChronyFloat(0.001)), "chrony_sourcestats_offset_error_seconds", labels...)
+			expectMetric(t, families, chronyFloatValue(toChronyFloat(-0.125)), "chrony_sourcestats_residual_frequency_ppms", labels...)
+			expectMetric(t, families, 8, "chrony_sourcestats_samples", labels...)
+			expectMetric(t, families, 5, "chrony_sourcestats_runs", labels...)
+			expectMetric(t, families, 512, "chrony_sourcestats_span_seconds", labels...)
+		})
+	}
+}
+
+func TestSourcestatsRemovedDuringEnumeration(t *testing.T) {
+	stats := make([]fakeSourceStats, 3)
+	for i := range stats {
+		stats[i] = fakeSourceStats{RefID: uint32(i + 1), IPAddr: newFakeIPAddr(fmt.Sprintf("192.0.2.%d", i+1)), NSamples: 8}
+	}
+	handle := sourcestatsHandler(stats)
+	// The second source is removed after the 'sources' reply.
+	address := newFakeChrony(t, func(req fakeRequest) []byte {
+		if req.command == fakeReqSourceStats && req.index == 1 {
+			return fakeStatus(req, statusNoSuchSource)
+		}
+		return handle(req)
+	})
+	e := newTestExporter(address, ChronyCollectorConfig{CollectSourcestats: true})
+	families := gatherMetrics(t, e)
+
+	expectMetric(t, families, 1, "chrony_up")
+	expectMetric(t, families, 1, "chrony_collector_up", "collector", "sourcestats")
+	expectMetric(t, families, 1, "chrony_sources_enumeration_mismatch_total")
+	expectMetric(t, families, 8, "chrony_sourcestats_samples", "source_address", "192.0.2.1")
+	if n := metricCount(families, "chrony_sourcestats_samples"); n != 1 {
+		t.Errorf("chrony_sourcestats_samples: got %d sources, want 1", n)
+	}
+}
+
+func TestSourcestatsFailed(t *testing.T) {
+	handle := sourcestatsHandler([]fakeSourceStats{{NSamples: 8}})
+	address := newFakeChrony(t, func(req fakeRequest) []byte {
+		if req.command == fakeReqSourceStats {
+			return fakeStatus(req, 1)
+		}
+		return handle(req)
+	})
+	e := newTestExporter(address, ChronyCollectorConfig{CollectSourcestats: true})
+	families := gatherMetrics(t, e)
+
+	expectMetric(t, families, 0, "chrony_up")
+	expectMetric(t, families, 0, "chrony_collector_up", "collector", "sourcestats")
+}
@@ -0,0 +1,73 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sync"
+	"time"
+)
+
+// clockSteps detects steps of the system clock between scrapes. It is
+// shared by concurrent scrapes.
+//
+// Slewing changes the rate of both the wall clock and the monotonic clock,
+// while a step only moves the wall clock. A step is detected when the wall
+// clock time elapsed since the previous scrape differs from the monotonic
+// time elapsed by more than the threshold.
+type clockSteps struct {
+	mtx       sync.Mutex
+	threshold time.Duration
+	// clock returns the wall clock time and the monotonic time.
+	clock func() (time.Time, time.Duration)
+
+	observed      bool
+	lastWall      time.Time
+	lastMonotonic time.Duration
+	total         uint64
+}
+
+func newClockSteps(threshold time.Duration) *clockSteps {
+	return &clockSteps{threshold: threshold, clock: systemClock}
+}
+
+// processStart is the reference of the monotonic time of systemClock.
+var processStart = time.Now()
+
+// systemClock returns the wall clock time and the monotonic time elapsed
+// since the process started.
+func systemClock() (time.Time, time.Duration) {
+	now := time.Now()
+	return now.Round(0), now.Sub(processStart)
+}
+
+// observe records the time of a scrape and returns the total number of
+// steps detected.
+func (s *clockSteps) observe() uint64 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	wall, monotonic := s.clock()
+	if s.observed && monotonic > s.lastMonotonic {
+		step := wall.Sub(s.lastWall) - (monotonic - s.lastMonotonic)
+		if step > s.threshold || step < -s.threshold {
+			s.total++
+		}
+	}
+	if !s.observed || monotonic > s.lastMonotonic {
+		s.observed = true
+		s.lastWall = wall
+		s.lastMonotonic = monotonic
+	}
+	return s.total
+}
@@ -0,0 +1,82 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a wall clock and monotonic clock advanced by the test.
+type fakeClock struct {
+	wall      time.Time
+	monotonic time.Duration
+}
+
+func (c *fakeClock) now() (time.Time, time.Duration) {
+	return c.wall, c.monotonic
+}
+
+func TestClockSteps(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		wall      time.Duration
+		monotonic time.Duration
+		want      uint64
+	}{
+		{name: "no change", wall: 15 * time.Second, monotonic: 15 * time.Second},
+		{name: "slew within threshold", wall: 15*time.Second + 5*time.Millisecond, monotonic: 15 * time.Second},
+		{name: "forward step", wall: 15*time.Second + 50*time.Millisecond, monotonic: 15 * time.Second, want: 1},
+		{name: "backward step", wall: 14 * time.Second, monotonic: 15 * time.Second, want: 1},
+		{name: "wall clock set back before the last scrape", wall: -time.Hour, monotonic: 15 * time.Second, want: 1},
+		{name: "concurrent scrape", wall: 0, monotonic: 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := &fakeClock{wall: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), monotonic: time.Minute}
+			steps := newClockSteps(10 * time.Millisecond)
+			steps.clock = clock.now
+
+			if got := steps.observe(); got != 0 {
+				t.Fatalf("first scrape: got %d steps, want 0", got)
+			}
+			clock.wall = clock.wall.Add(tc.wall)
+			clock.monotonic += tc.monotonic
+			if got := steps.observe(); got != tc.want {
+				t.Errorf("got %d steps, want %d", got, tc.want)
+			}
+			// The step is counted once.
+			clock.wall = clock.wall.Add(15 * time.Second)
+			clock.monotonic += 15 * time.Second
+			if got := steps.observe(); got != tc.want {
+				t.Errorf("next scrape: got %d steps, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestClockStepsTransport(t *testing.T) {
+	for _, tc := range []struct {
+		address string
+		want    bool
+	}{
+		{address: "unix:///run/chrony/chronyd.sock", want: true},
+		{address: "[::1]:323"},
+		{address: "tcp://192.0.2.1:3230"},
+	} {
+		e := newTestExporter(tc.address, ChronyCollectorConfig{TrackingStepThreshold: time.Millisecond})
+		if got := e.clockSteps != nil; got != tc.want {
+			t.Errorf("%s: got steps enabled %t, want %t", tc.address, got, tc.want)
+		}
+	}
+}
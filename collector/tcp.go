@@ -0,0 +1,57 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+)
+
+// framedConn carries chrony command packets over a stream connection to a
+// chrony command bridge. Each packet is prefixed with its length as a 2 byte
+// big-endian integer, the same framing as DNS over TCP.
+type framedConn struct {
+	net.Conn
+}
+
+// Write sends p as a single packet, the chrony client writes each request
+// with a single call.
+func (c framedConn) Write(p []byte) (int, error) {
+	if len(p) > math.MaxUint16 {
+		return 0, fmt.Errorf("packet too large: %d bytes", len(p))
+	}
+	buf := make([]byte, 2+len(p))
+	binary.BigEndian.PutUint16(buf, uint16(len(p)))
+	copy(buf[2:], p)
+	if _, err := c.Conn.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Read reads a single packet into p.
+func (c framedConn) Read(p []byte) (int, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(c.Conn, length[:]); err != nil {
+		return 0, err
+	}
+	n := int(binary.BigEndian.Uint16(length[:]))
+	if n > len(p) {
+		return 0, fmt.Errorf("packet too large: %d bytes", n)
+	}
+	return io.ReadFull(c.Conn, p[:n])
+}
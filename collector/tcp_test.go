@@ -0,0 +1,124 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+)
+
+// newFakeChronyBridge starts a fake chrony command bridge on a local TCP
+// socket, framing each packet with its length, and returns its address.
+func newFakeChronyBridge(tb testing.TB, handle fakeHandler) string {
+	tb.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeChronyBridge(conn, handle)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func serveFakeChronyBridge(conn net.Conn, handle fakeHandler) {
+	defer conn.Close()
+	for {
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return
+		}
+		buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+		req, ok := parseFakeRequest(buf)
+		if !ok {
+			continue
+		}
+		reply := handle(req)
+		if reply == nil {
+			continue
+		}
+		framed := binary.BigEndian.AppendUint16(nil, uint16(len(reply)))
+		if _, err := conn.Write(append(framed, reply...)); err != nil {
+			return
+		}
+	}
+}
+
+func TestTCPBridge(t *testing.T) {
+	address := newFakeChronyBridge(t, sourcesHandler(newTestSources(3)))
+	e := newTestExporter("tcp://"+address, ChronyCollectorConfig{CollectSources: true})
+	families := gatherMetrics(t, e)
+
+	expectMetric(t, families, 1, "chrony_up")
+	expectMetric(t, families, 1, "chrony_collector_up", "collector", "sources")
+	expectMetric(t, families, 1, "chrony_exporter_transport", "type", "tcp")
+	if n := metricCount(families, "chrony_sources_stratum"); n != 3 {
+		t.Errorf("chrony_sources_stratum: got %d sources, want 3", n)
+	}
+}
+
+func TestFramedConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	conn := framedConn{client}
+
+	go func() {
+		// Two packets in a single write are read one at a time.
+		server.Write([]byte{0, 3, 'a', 'b', 'c', 0, 1, 'd'})
+	}()
+	for _, want := range []string{"abc", "d"} {
+		buf := make([]byte, 16)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(buf[:n]); got != want {
+			t.Errorf("Read: got %q, want %q", got, want)
+		}
+	}
+
+	go func() {
+		server.Write([]byte{0, 4, 'a', 'b', 'c', 'd'})
+	}()
+	if _, err := conn.Read(make([]byte, 2)); err == nil {
+		t.Error("Read of a packet larger than the buffer: got no error")
+	}
+
+	received := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, 16)
+		n, _ := io.ReadAtLeast(server, buf, 5)
+		received <- buf[:n]
+	}()
+	if n, err := conn.Write([]byte("xyz")); err != nil || n != 3 {
+		t.Fatalf("Write: got %d, %v, want 3, nil", n, err)
+	}
+	if got, want := <-received, []byte{0, 3, 'x', 'y', 'z'}; !bytes.Equal(got, want) {
+		t.Errorf("Write: sent %v, want %v", got, want)
+	}
+}
@@ -14,9 +14,12 @@
 package collector
 
 import (
+	"encoding/binary"
 	"fmt"
 	"log/slog"
+	"math"
 	"net"
+	"time"
 
 	"github.com/facebook/time/ntp/chrony"
 	"github.com/prometheus/client_golang/prometheus"
@@ -24,11 +27,15 @@ import (
 
 const (
 	trackingSubsystem = "tracking"
+
+	// trackingLeapUnsynchronised is the chrony LEAP_Unsynchronised status.
+	trackingLeapUnsynchronised = 3
 )
 
 var (
-	// The remote IP 127.127.1.1 means it is a "local" reference clock.
-	trackingLocalIP = net.IPv4(127, 127, 1, 1)
+	// Remote IPs in 127.127.0.0/16, such as 127.127.1.1, are "local"
+	// reference clocks.
+	trackingLocalNetwork = &net.IPNet{IP: net.IPv4(127, 127, 0, 0), Mask: net.CIDRMask(16, 32)}
 
 	trackingInfo = typedDesc{
 		prometheus.NewDesc(
@@ -60,6 +67,16 @@ var (
 		prometheus.GaugeValue,
 	}
 
+	trackingRefTimeMilliseconds = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, trackingSubsystem, "reference_timestamp_milliseconds"),
+			"Chrony tracking Reference timestamp in milliseconds",
+			nil,
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
 	trackingSystemTime = typedDesc{
 		prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, trackingSubsystem, "system_time_seconds"),
@@ -110,6 +127,68 @@ var (
 		prometheus.GaugeValue,
 	}
 
+	// The estimated error is the root distance used by chrony, half the root
+	// delay plus the root dispersion.
+	trackingEstimatedError = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, trackingSubsystem, "estimated_error_seconds"),
+			"Chrony tracking estimated error bound (root delay / 2 + root dispersion) in seconds",
+			nil,
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	trackingOffsetDeviation = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, trackingSubsystem, "offset_deviation_seconds"),
+			"Chrony tracking last offset minus the rolling mean of the last offsets in seconds",
+			nil,
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	trackingStepsDetected = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, trackingSubsystem, "steps_detected_total"),
+			"Number of system clock steps detected between scrapes",
+			nil,
+			nil,
+		),
+		prometheus.CounterValue,
+	}
+
+	trackingOffsetJitter = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, trackingSubsystem, "offset_jitter_seconds"),
+			"Chrony tracking standard deviation of the system time offset over the samples taken in a scrape in seconds",
+			nil,
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	trackingSynchronized = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, trackingSubsystem, "synchronized"),
+			"Chrony tracking is synchronised to a source, the offset metrics are omitted when 0",
+			nil,
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
+	trackingLeapStatus = typedDesc{
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, trackingSubsystem, "leap_status"),
+			"Chrony tracking leap status, 0 normal, 1 insert second, 2 delete second, 3 not synchronised",
+			nil,
+			nil,
+		),
+		prometheus.GaugeValue,
+	}
+
 	trackingFrequency = typedDesc{
 		prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, trackingSubsystem, "frequency_ppms"),
@@ -168,59 +247,147 @@ func (e Exporter) trackingFormatName(logger *slog.Logger, tracking chrony.Tracki
 	return e.dnsLookup(logger, tracking.IPAddr)
 }
 
-func (e Exporter) getTrackingMetrics(logger *slog.Logger, ch chan<- prometheus.Metric, client chrony.Client) error {
-	packet, err := client.Communicate(chrony.NewTrackingPacket())
+// sampleTrackingJitter takes additional tracking samples until there are
+// trackingSamples or the timeout since start is reached, and returns the
+// standard deviation of the system time offset.
+func (e Exporter) sampleTrackingJitter(logger *slog.Logger, client *chrony.Client, start time.Time, first chrony.Tracking) (float64, bool) {
+	offsets := []float64{first.CurrentCorrection}
+	deadline := start.Add(e.timeout)
+	for len(offsets) < e.trackingSamples && time.Now().Before(deadline) {
+		packet, err := e.communicate(client, "tracking", chrony.NewTrackingPacket())
+		if err != nil {
+			logger.Debug("Couldn't get tracking sample", "err", err)
+			break
+		}
+		tracking, ok := packet.(*chrony.ReplyTracking)
+		if !ok {
+			logger.Debug("Got wrong 'tracking' sample response", "packet", packet)
+			break
+		}
+		offsets = append(offsets, tracking.CurrentCorrection)
+	}
+	if len(offsets) < 2 {
+		return 0, false
+	}
+
+	var sum float64
+	for _, o := range offsets {
+		sum += o
+	}
+	mean := sum / float64(len(offsets))
+	var variance float64
+	for _, o := range offsets {
+		variance += (o - mean) * (o - mean)
+	}
+	return math.Sqrt(variance / float64(len(offsets))), true
+}
+
+// trackingSynchronised returns false before chrony has selected a source,
+// when the reference ID is zero or the leap status is unsynchronised.
+func trackingSynchronised(tracking chrony.Tracking) bool {
+	return tracking.RefID != 0 && tracking.LeapStatus != trackingLeapUnsynchronised
+}
+
+// trackingSelection identifies the source selected by tracking. It is empty
+// when chrony is not synchronised.
+type trackingSelection struct {
+	// refID is the refid of the source as hex.
+	refID string
+	// address is the address of the source. Reference clocks have no address,
+	// so the refid is encoded as an IPv4 address to match the sources
+	// collector.
+	address net.IP
+}
+
+// newTrackingSelection returns the selection of a synchronised tracking reply.
+func newTrackingSelection(tracking chrony.Tracking) trackingSelection {
+	address := tracking.IPAddr
+	if address.IsUnspecified() {
+		address = make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(address, tracking.RefID)
+	}
+	return trackingSelection{refID: chrony.RefidAsHEX(tracking.RefID), address: address}
+}
+
+// getTrackingMetrics returns the source selected by tracking.
+func (e Exporter) getTrackingMetrics(logger *slog.Logger, ch chan<- prometheus.Metric, client chrony.Client) (trackingSelection, error) {
+	start := time.Now()
+	packet, err := e.communicate(&client, "tracking", chrony.NewTrackingPacket())
 	if err != nil {
-		return err
+		return trackingSelection{}, err
 	}
 	logger.Debug("Got 'tracking' response", "tracking_packet", packet.GetStatus())
 
 	tracking, ok := packet.(*chrony.ReplyTracking)
 	if !ok {
-		return fmt.Errorf("Got wrong 'tracking' response: %q", packet)
+		return trackingSelection{}, fmt.Errorf("Got wrong 'tracking' response: %q", packet)
 	}
 
-	ch <- trackingInfo.mustNewConstMetric(1.0, tracking.IPAddr.String(), e.trackingFormatName(logger, tracking.Tracking), chrony.RefidAsHEX(tracking.RefID))
-
-	ch <- trackingLastOffset.mustNewConstMetric(tracking.LastOffset)
-	logger.Debug("Tracking Last Offset", "offset", tracking.LastOffset)
+	return e.exportTrackingMetrics(logger, ch, &client, start, tracking.Tracking), nil
+}
 
-	ch <- trackingRefTime.mustNewConstMetric(float64(tracking.RefTime.UnixNano()) / 1e9)
+// exportTrackingMetrics exports the tracking metrics and returns the selected
+// source. The offset jitter is only sampled with a client.
+func (e Exporter) exportTrackingMetrics(logger *slog.Logger, ch chan<- prometheus.Metric, client *chrony.Client, start time.Time, tracking chrony.Tracking) trackingSelection {
+	ch <- trackingInfo.mustNewConstMetric(e.metricOpts, 1.0, tracking.IPAddr.String(), e.trackingFormatName(logger, tracking), chrony.RefidAsHEX(tracking.RefID))
+
+	// The offsets are left over from before chrony lost synchronisation, or
+	// zero, when not synchronised.
+	synchronised := trackingSynchronised(tracking)
+	if synchronised {
+		ch <- trackingSynchronized.mustNewConstMetric(e.metricOpts, 1.0)
+		ch <- trackingLastOffset.mustNewConstMetric(e.metricOpts, tracking.LastOffset)
+		logger.Debug("Tracking Last Offset", "offset", tracking.LastOffset)
+		ch <- trackingRMSOffset.mustNewConstMetric(e.metricOpts, tracking.RMSOffset)
+		logger.Debug("Tracking RMS Offset", "rms_offset", tracking.RMSOffset)
+		if e.offsetBaseline != nil {
+			ch <- trackingOffsetDeviation.mustNewConstMetric(e.metricOpts, e.offsetBaseline.deviation(tracking.RefTime, tracking.LastOffset))
+		}
+		ch <- trackingSystemTime.mustNewConstMetric(e.metricOpts, float64(tracking.CurrentCorrection))
+		logger.Debug("Tracking System Time", "system_time", tracking.CurrentCorrection)
+		if e.trackingSamples > 1 && client != nil {
+			if jitter, ok := e.sampleTrackingJitter(logger, client, start, tracking); ok {
+				ch <- trackingOffsetJitter.mustNewConstMetric(e.metricOpts, jitter)
+			}
+		}
+	} else {
+		logger.Debug("Chrony is not synchronised", "tracking_refid", chrony.RefidAsHEX(tracking.RefID), "leap_status", tracking.LeapStatus)
+		ch <- trackingSynchronized.mustNewConstMetric(e.metricOpts, 0.0)
+	}
+	if e.clockSteps != nil {
+		ch <- trackingStepsDetected.mustNewConstMetric(e.metricOpts, float64(e.clockSteps.observe()))
+	}
+	ch <- trackingRefTime.mustNewConstMetric(e.metricOpts, float64(tracking.RefTime.UnixNano())/1e9)
 	logger.Debug("Tracking Ref Time", "ref_time", tracking.RefTime)
-
-	ch <- trackingSystemTime.mustNewConstMetric(float64(tracking.CurrentCorrection))
-	logger.Debug("Tracking System Time", "system_time", tracking.CurrentCorrection)
-
+	if e.timestampsMilliseconds {
+		ch <- trackingRefTimeMilliseconds.mustNewConstMetric(e.metricOpts, float64(tracking.RefTime.UnixMilli()))
+	}
 	remoteTracking := 1.0
-	if tracking.IPAddr.Equal(trackingLocalIP) {
+	if trackingLocalNetwork.Contains(tracking.IPAddr) {
 		remoteTracking = 0.0
 	}
-	ch <- trackingRemoteTracking.mustNewConstMetric(remoteTracking)
+	ch <- trackingRemoteTracking.mustNewConstMetric(e.metricOpts, remoteTracking)
 	logger.Debug("Tracking is remote", "bool_value", remoteTracking)
 
-	ch <- trackingRMSOffset.mustNewConstMetric(tracking.RMSOffset)
-	logger.Debug("Tracking RMS Offset", "rms_offset", tracking.RMSOffset)
-
-	ch <- trackingRootDelay.mustNewConstMetric(tracking.RootDelay)
+	ch <- trackingRootDelay.mustNewConstMetric(e.metricOpts, tracking.RootDelay)
 	logger.Debug("Tracking Root delay", "root_delay", tracking.RootDelay)
-
-	ch <- trackingRootDispersion.mustNewConstMetric(tracking.RootDispersion)
+	ch <- trackingRootDispersion.mustNewConstMetric(e.metricOpts, tracking.RootDispersion)
 	logger.Debug("Tracking Root dispersion", "root_dispersion", tracking.RootDispersion)
-
-	ch <- trackingFrequency.mustNewConstMetric(tracking.FreqPPM)
+	ch <- trackingEstimatedError.mustNewConstMetric(e.metricOpts, tracking.RootDelay/2+tracking.RootDispersion)
+	ch <- trackingLeapStatus.mustNewConstMetric(e.metricOpts, float64(tracking.LeapStatus))
+	ch <- trackingFrequency.mustNewConstMetric(e.metricOpts, tracking.FreqPPM)
 	logger.Debug("Tracking Frequency", "frequency", tracking.FreqPPM)
-
-	ch <- trackingResidualFrequency.mustNewConstMetric(tracking.ResidFreqPPM)
+	ch <- trackingResidualFrequency.mustNewConstMetric(e.metricOpts, tracking.ResidFreqPPM)
 	logger.Debug("Tracking Residual Frequency", "residual_frequency", tracking.ResidFreqPPM)
-
-	ch <- trackingSkew.mustNewConstMetric(tracking.SkewPPM)
+	ch <- trackingSkew.mustNewConstMetric(e.metricOpts, tracking.SkewPPM)
 	logger.Debug("Tracking Skew", "skew", tracking.SkewPPM)
-
-	ch <- trackingUpdateInterval.mustNewConstMetric(tracking.LastUpdateInterval)
+	ch <- trackingUpdateInterval.mustNewConstMetric(e.metricOpts, tracking.LastUpdateInterval)
 	logger.Debug("Tracking Last Update Interval", "update_interval", tracking.LastUpdateInterval)
-
-	ch <- trackingStratum.mustNewConstMetric(float64(tracking.Stratum))
+	ch <- trackingStratum.mustNewConstMetric(e.metricOpts, float64(tracking.Stratum))
 	logger.Debug("Tracking Stratum", "stratum", tracking.Stratum)
 
-	return nil
+	if !synchronised {
+		return trackingSelection{}
+	}
+	return newTrackingSelection(tracking)
 }
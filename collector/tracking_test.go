@@ -0,0 +1,201 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/facebook/time/ntp/chrony"
+)
+
+// trackingHandler replies to the tracking requests with tracking, and to
+// other requests as invalid.
+func trackingHandler(tracking fakeTracking) fakeHandler {
+	return func(req fakeRequest) []byte {
+		if req.command == fakeReqTracking {
+			return fakeReply(req, chrony.RpyTracking, statusSuccess, tracking)
+		}
+		return fakeStatus(req, statusInvalid)
+	}
+}
+
+// newTestTracking returns tracking synchronised to 192.0.2.1.
+func newTestTracking() fakeTracking {
+	return fakeTracking{
+		RefID:             0xc0000201,
+		IPAddr:            newFakeIPAddr("192.0.2.1"),
+		Stratum:           3,
+		RefTimeSecLow:     uint32(time.Now().Unix()),
+		CurrentCorrection: toChronyFloat(0.001),
+		LastOffset:        toChronyFloat(0.002),
+		RMSOffset:         toChronyFloat(0.003),
+		RootDelay:         toChronyFloat(0.02),
+		RootDispersion:    toChronyFloat(0.001),
+	}
+}
+
+// trackingOffsetMetrics are derived from the offsets, which are left over
+// from before chrony lost synchronisation.
+var trackingOffsetMetrics = []string{
+	"chrony_tracking_last_offset_seconds",
+	"chrony_tracking_rms_offset_seconds",
+	"chrony_tracking_system_time_seconds",
+	"chrony_tracking_offset_deviation_seconds",
+	"chrony_tracking_offset_jitter_seconds",
+}
+
+func TestTrackingOffsetsSynchronised(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		refID        uint32
+		leapStatus   uint16
+		synchronised bool
+	}{
+		{name: "synchronised", refID: 0xc0000201, synchronised: true},
+		{name: "no reference", refID: 0},
+		{name: "unsynchronised leap status", refID: 0xc0000201, leapStatus: trackingLeapUnsynchronised},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tracking := newTestTracking()
+			tracking.RefID = tc.refID
+			tracking.LeapStatus = tc.leapStatus
+			address := newFakeChrony(t, trackingHandler(tracking))
+			e := newTestExporter(address, ChronyCollectorConfig{
+				CollectTracking:              true,
+				TrackingSamples:              3,
+				TrackingOffsetBaselineWindow: time.Hour,
+			})
+			families := gatherMetrics(t, e)
+
+			expectMetric(t, families, 1, "chrony_up")
+			want := 0.0
+			if tc.synchronised {
+				want = 1
+			}
+			expectMetric(t, families, want, "chrony_tracking_synchronized")
+			for _, name := range trackingOffsetMetrics {
+				if _, ok := metricValue(families, name); ok != tc.synchronised {
+					t.Errorf("%s: got present %t, want %t", name, ok, tc.synchronised)
+				}
+			}
+			// The other tracking metrics don't depend on synchronisation.
+			expectMetric(t, families, 3, "chrony_tracking_stratum")
+		})
+	}
+}
+
+func TestTrackingRemoteReference(t *testing.T) {
+	for _, tc := range []struct {
+		address string
+		want    float64
+	}{
+		{address: "127.127.1.1", want: 0},
+		{address: "127.127.2.1", want: 0},
+		{address: "127.127.28.0", want: 0},
+		{address: "127.0.0.1", want: 1},
+		{address: "192.0.2.1", want: 1},
+		{address: "2001:db8::1", want: 1},
+	} {
+		t.Run(tc.address, func(t *testing.T) {
+			tracking := newTestTracking()
+			tracking.IPAddr = newFakeIPAddr(tc.address)
+			address := newFakeChrony(t, trackingHandler(tracking))
+			families := gatherMetrics(t, newTestExporter(address, ChronyCollectorConfig{CollectTracking: true}))
+
+			expectMetric(t, families, tc.want, "chrony_tracking_remote_reference")
+		})
+	}
+}
+
+func TestTrackingFields(t *testing.T) {
+	refTime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tracking := fakeTracking{
+		RefID:              0xc0000201,
+		IPAddr:             newFakeIPAddr("192.0.2.1"),
+		Stratum:            3,
+		LeapStatus:         1,
+		RefTimeSecLow:      uint32(refTime.Unix()),
+		CurrentCorrection:  toChronyFloat(0.0001),
+		LastOffset:         toChronyFloat(-0.0002),
+		RMSOffset:          toChronyFloat(0.0003),
+		FreqPPM:            toChronyFloat(-12.5),
+		ResidFreqPPM:       toChronyFloat(0.004),
+		SkewPPM:            toChronyFloat(0.05),
+		RootDelay:          toChronyFloat(0.02),
+		RootDispersion:     toChronyFloat(0.001),
+		LastUpdateInterval: toChronyFloat(64),
+	}
+	address := newFakeChrony(t, trackingHandler(tracking))
+	families := gatherMetrics(t, newTestExporter(address, ChronyCollectorConfig{CollectTracking: true}))
+
+	// Every numeric field of the tracking reply maps to a metric.
+	for _, tc := range []struct {
+		field  string
+		metric string
+		want   float64
+	}{
+		{field: "Stratum", metric: "chrony_tracking_stratum", want: 3},
+		{field: "LeapStatus", metric: "chrony_tracking_leap_status", want: 1},
+		{field: "RefTime", metric: "chrony_tracking_reference_timestamp_seconds", want: float64(refTime.Unix())},
+		{field: "CurrentCorrection", metric: "chrony_tracking_system_time_seconds", want: chronyFloatValue(tracking.CurrentCorrection)},
+		{field: "LastOffset", metric: "chrony_tracking_last_offset_seconds", want: chronyFloatValue(tracking.LastOffset)},
+		{field: "RMSOffset", metric: "chrony_tracking_rms_offset_seconds", want: chronyFloatValue(tracking.RMSOffset)},
+		{field: "FreqPPM", metric: "chrony_tracking_frequency_ppms", want: chronyFloatValue(tracking.FreqPPM)},
+		{field: "ResidFreqPPM", metric: "chrony_tracking_residual_frequency_ppms", want: chronyFloatValue(tracking.ResidFreqPPM)},
+		{field: "SkewPPM", metric: "chrony_tracking_skew_ppms", want: chronyFloatValue(tracking.SkewPPM)},
+		{field: "RootDelay", metric: "chrony_tracking_root_delay_seconds", want: chronyFloatValue(tracking.RootDelay)},
+		{field: "RootDispersion", metric: "chrony_tracking_root_dispersion_seconds", want: chronyFloatValue(tracking.RootDispersion)},
+		{field: "LastUpdateInterval", metric: "chrony_tracking_update_interval_seconds", want: 64},
+	} {
+		t.Run(tc.field, func(t *testing.T) {
+			expectMetric(t, families, tc.want, tc.metric)
+		})
+	}
+	// The reference ID and address are labels of the info metric.
+	expectMetric(t, families, 1, "chrony_tracking_info", "tracking_address", "192.0.2.1", "tracking_refid", "C0000201")
+}
+
+func TestTrackingEstimatedError(t *testing.T) {
+	for _, tc := range []struct {
+		rootDelay      float64
+		rootDispersion float64
+		want           float64
+	}{
+		{rootDelay: 0, rootDispersion: 0, want: 0},
+		{rootDelay: 0.5, rootDispersion: 0, want: 0.25},
+		{rootDelay: 0, rootDispersion: 0.125, want: 0.125},
+		{rootDelay: 0.5, rootDispersion: 0.25, want: 0.5},
+		{rootDelay: 0.02, rootDispersion: 0.001, want: 0.011},
+	} {
+		t.Run(fmt.Sprintf("%g/%g", tc.rootDelay, tc.rootDispersion), func(t *testing.T) {
+			tracking := newTestTracking()
+			tracking.RootDelay = toChronyFloat(tc.rootDelay)
+			tracking.RootDispersion = toChronyFloat(tc.rootDispersion)
+			address := newFakeChrony(t, trackingHandler(tracking))
+			families := gatherMetrics(t, newTestExporter(address, ChronyCollectorConfig{CollectTracking: true}))
+
+			// The estimated error is RootDelay/2 + RootDispersion.
+			got, ok := metricValue(families, "chrony_tracking_estimated_error_seconds")
+			if !ok {
+				t.Fatal("chrony_tracking_estimated_error_seconds: missing")
+			}
+			if math.Abs(got-tc.want) > 1e-6 {
+				t.Errorf("chrony_tracking_estimated_error_seconds: got %g, want %g", got, tc.want)
+			}
+		})
+	}
+}
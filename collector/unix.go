@@ -0,0 +1,91 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// redialConn is a unix datagram connection to chrony that is replaced by a
+// fresh socket once when a read times out, as a timed out socket is
+// effectively dead for the rest of the scrape.
+type redialConn struct {
+	net.Conn
+	redial   func() (net.Conn, error)
+	redialed bool
+}
+
+// reconnect replaces the connection with a fresh socket. It fails when the
+// connection was already replaced.
+func (c *redialConn) reconnect() error {
+	if c.redialed {
+		return fmt.Errorf("unix socket already redialed")
+	}
+	c.redialed = true
+	c.Conn.Close()
+	conn, err := c.redial()
+	if err != nil {
+		return err
+	}
+	c.Conn = conn
+	return nil
+}
+
+// dialUnix binds the receiving unix datagram socket next to the chrony
+// socket and connects it.
+func (e Exporter) dialUnix() (net.Conn, error, func()) {
+	remote := strings.TrimPrefix(e.address, "unix://")
+	base, _ := path.Split(remote)
+	name := fmt.Sprintf("chrony_exporter.%d.sock", os.Getpid())
+	if e.worker > 0 {
+		// Each sources worker binds its own receiving socket.
+		name = fmt.Sprintf("chrony_exporter.%d.%d.sock", os.Getpid(), e.worker)
+	}
+	local := path.Join(base, name)
+	dial := func() (net.Conn, error) {
+		conn, err := net.DialUnix("unixgram",
+			&net.UnixAddr{Name: local, Net: "unixgram"},
+			&net.UnixAddr{Name: remote, Net: "unixgram"},
+		)
+		if err != nil {
+			return nil, err
+		}
+		if e.chmodSocket {
+			if err := os.Chmod(local, 0666); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		err = conn.SetReadDeadline(time.Now().Add(e.timeout))
+		if err != nil {
+			e.logger.Debug("Couldn't set read-timeout for unix datagram socket", "err", err)
+		}
+		return conn, nil
+	}
+	conn, err := dial()
+	if err != nil {
+		return nil, err, func() { os.Remove(local) }
+	}
+	rc := &redialConn{Conn: conn, redial: func() (net.Conn, error) {
+		// The closed socket must be removed before binding it again.
+		os.Remove(local)
+		return dial()
+	}}
+	return rc, nil, func() { rc.Conn.Close(); os.Remove(local) }
+}
@@ -0,0 +1,81 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newFakeChronyUnix starts a fake chrony on a unix datagram socket in a
+// temporary directory and returns its address.
+func newFakeChronyUnix(t *testing.T, handle fakeHandler) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "chronyd.sock")
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go serveFakeChrony(conn, handle, 0)
+	return "unix://" + path
+}
+
+func TestUnixRetryOnFreshSocket(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+	handle := sourcesHandler(newTestSources(2))
+	requests := 0
+	// The reply to the first request is dropped.
+	address := newFakeChronyUnix(t, func(req fakeRequest) []byte {
+		requests++
+		if requests == 1 {
+			return nil
+		}
+		return handle(req)
+	})
+	e := newTestExporter(address, ChronyCollectorConfig{CollectSources: true, Timeout: timeout})
+
+	start := time.Now()
+	families := gatherMetrics(t, e)
+	elapsed := time.Since(start)
+
+	expectMetric(t, families, 1, "chrony_up")
+	expectMetric(t, families, 1, "chrony_collector_up", "collector", "sources")
+	expectMetric(t, families, 1, "chrony_exporter_command_retries_total", "command", "sources")
+	if n := metricCount(families, "chrony_sources_stratum"); n != 2 {
+		t.Errorf("chrony_sources_stratum: got %d sources, want 2", n)
+	}
+	if elapsed < timeout {
+		t.Errorf("scrape took %s, want the first read to time out after %s", elapsed, timeout)
+	}
+}
+
+func TestUnixRetryTimeout(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+	address := newFakeChronyUnix(t, func(req fakeRequest) []byte { return nil })
+	e := newTestExporter(address, ChronyCollectorConfig{CollectSources: true, Timeout: timeout})
+
+	start := time.Now()
+	families := gatherMetrics(t, e)
+	elapsed := time.Since(start)
+
+	expectMetric(t, families, 0, "chrony_up")
+	// The command is retried once, on a socket with a new timeout.
+	expectMetric(t, families, 1, "chrony_exporter_command_retries_total", "command", "sources")
+	if elapsed < 2*timeout || elapsed > 3*timeout {
+		t.Errorf("scrape took %s, want between %s and %s", elapsed, 2*timeout, 3*timeout)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/facebook/time/ntp/chrony"
+)
+
+// fetchSourcesParallel requests the sourcedata of n sources spread over up
+// to sourcesWorkers connections, the first of which is client. Each
+// additional worker dials its own connection, so that the workers don't
+// share a sequence number. Workers that can't connect are skipped. The
+// replies and errors are returned in the order of the source indexes.
+func (e Exporter) fetchSourcesParallel(logger *slog.Logger, client *chrony.Client, n int) ([]chrony.ResponsePacket, []error) {
+	clients := []*chrony.Client{client}
+	for w := 1; w < e.sourcesWorkers && w < n; w++ {
+		worker := e
+		worker.worker = w
+		dialStart := time.Now()
+		conn, err, cleanup := worker.dial()
+		if e.timings != nil {
+			e.timings.dial += time.Since(dialStart)
+		}
+		defer cleanup()
+		if err != nil {
+			logger.Debug("Couldn't connect sources worker, continuing with fewer workers", "worker", w, "err", err)
+			break
+		}
+		clients = append(clients, &chrony.Client{Sequence: initialSequence, Connection: conn})
+	}
+
+	replies := make([]chrony.ResponsePacket, n)
+	errs := make([]error, n)
+	timings := make([]scrapeTimings, len(clients))
+	var wg sync.WaitGroup
+	for w, c := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker := e
+			worker.timings = &timings[w]
+			for i := w; i < n; i += len(clients) {
+				replies[i], errs[i] = worker.communicate(c, "sourcedata", chrony.NewSourceDataPacket(int32(i)))
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The workers run concurrently, so the slowest one is the time spent.
+	if e.timings != nil {
+		var slowest time.Duration
+		for _, t := range timings {
+			slowest = max(slowest, t.command)
+		}
+		e.timings.command += slowest
+	}
+	return replies, errs
+}
@@ -0,0 +1,86 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+const (
+	// benchmarkSources is the number of sources of a large server.
+	benchmarkSources = 200
+	// benchmarkLatency is the reply latency of the fake chrony.
+	benchmarkLatency = 100 * time.Microsecond
+)
+
+// expectSources fails the test unless the exporter returns all the sources
+// in order.
+func expectSources(t *testing.T, e Exporter, want []fakeSourceData) {
+	t.Helper()
+	sources, err := e.Sources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != len(want) {
+		t.Fatalf("got %d sources, want %d", len(sources), len(want))
+	}
+	for i, s := range sources {
+		// The test sources are IPv4 addresses.
+		if address := net.IP(want[i].IPAddr.IP[:net.IPv4len]); !s.IPAddr.Equal(address) {
+			t.Errorf("source %d: got %s, want %s", i, s.IPAddr, address)
+		}
+	}
+}
+
+// benchmarkSourceData fetches the sourcedata of benchmarkSources sources
+// from a fake chrony replying after benchmarkLatency.
+func benchmarkSourceData(b *testing.B, conf ChronyCollectorConfig) {
+	address := newSlowFakeChrony(b, benchmarkLatency, sourcesHandler(newTestSources(benchmarkSources)))
+	e := newTestExporter(address, conf)
+	b.ResetTimer()
+	for range b.N {
+		sources, err := e.Sources()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(sources) != benchmarkSources {
+			b.Fatalf("got %d sources, want %d", len(sources), benchmarkSources)
+		}
+	}
+}
+
+func TestSourcesWorkers(t *testing.T) {
+	sources := newTestSources(benchmarkSources)
+	address := newFakeChrony(t, sourcesHandler(sources))
+	for _, workers := range []int{2, 3, 8} {
+		t.Run(fmt.Sprint(workers), func(t *testing.T) {
+			expectSources(t, newTestExporter(address, ChronyCollectorConfig{SourcesWorkers: workers}), sources)
+		})
+	}
+}
+
+func BenchmarkSourcesSerial(b *testing.B) {
+	benchmarkSourceData(b, ChronyCollectorConfig{})
+}
+
+func BenchmarkSourcesWorkers(b *testing.B) {
+	for _, workers := range []int{2, 4, 8} {
+		b.Run(fmt.Sprint(workers), func(b *testing.B) {
+			benchmarkSourceData(b, ChronyCollectorConfig{SourcesWorkers: workers})
+		})
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// bufferedResponseWriter holds a response so that it can be inspected
+// before it is sent.
+type bufferedResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponseWriter) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponseWriter) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponseWriter) WriteHeader(status int) {
+	b.status = status
+}
+
+// etagGatherer derives an ETag from the metric families it gathers. The
+// exporter's own metrics change on every scrape, so they are excluded.
+type etagGatherer struct {
+	prometheus.Gatherer
+	etag string
+}
+
+func (g *etagGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	h := sha256.New()
+	for _, mf := range families {
+		if strings.HasPrefix(mf.GetName(), "chrony_exporter_") {
+			continue
+		}
+		expfmt.MetricFamilyToText(h, mf)
+	}
+	g.etag = `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+	return families, err
+}
+
+// etagHandler adds the ETag of the metrics gathered by next, and responds
+// with 304 Not Modified when it matches the If-None-Match header.
+func etagHandler(next http.Handler, g *etagGatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := &bufferedResponseWriter{header: w.Header(), status: http.StatusOK}
+		next.ServeHTTP(buf, r)
+
+		if buf.status != http.StatusOK || g.etag == "" {
+			w.WriteHeader(buf.status)
+			w.Write(buf.body.Bytes())
+			return
+		}
+
+		w.Header().Set("ETag", g.etag)
+		if r.Header.Get("If-None-Match") == g.etag {
+			w.Header().Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write(buf.body.Bytes())
+	})
+}
@@ -0,0 +1,103 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+var (
+	testUpDesc       = prometheus.NewDesc("chrony_up", "Whether the chrony server is up.", nil, nil)
+	testDurationDesc = prometheus.NewDesc("chrony_exporter_dns_duration_seconds", "Time spent in DNS lookups.", nil, nil)
+)
+
+// testChronyCollector exports chrony_up and a self metric that changes on
+// every scrape.
+type testChronyCollector struct {
+	up      *float64
+	scrapes *int
+}
+
+func (c testChronyCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c testChronyCollector) Collect(ch chan<- prometheus.Metric) {
+	*c.scrapes++
+	ch <- prometheus.MustNewConstMetric(testUpDesc, prometheus.GaugeValue, *c.up)
+	ch <- prometheus.MustNewConstMetric(testDurationDesc, prometheus.GaugeValue, float64(*c.scrapes)/1000)
+}
+
+func TestETag(t *testing.T) {
+	up, scrapes := 1.0, 0
+	// The runtime metrics of the default registry change on every scrape.
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector())
+	handler := metricsHandler(registry, func(context.Context) prometheus.Collector {
+		return testChronyCollector{up: &up, scrapes: &scrapes}
+	}, true)
+
+	scrape := func(etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := scrape("")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("first scrape: got status %d and ETag %q, want 200 with an ETag", first.Code, etag)
+	}
+	if first.Body.Len() == 0 {
+		t.Error("first scrape: got an empty body")
+	}
+
+	second := scrape(etag)
+	if second.Code != http.StatusNotModified {
+		t.Errorf("identical scrape: got status %d, want 304", second.Code)
+	}
+	if second.Body.Len() != 0 {
+		t.Errorf("identical scrape: got a %d byte body, want none", second.Body.Len())
+	}
+
+	up = 0
+	third := scrape(etag)
+	if third.Code != http.StatusOK {
+		t.Errorf("changed scrape: got status %d, want 200", third.Code)
+	}
+	if got := third.Header().Get("ETag"); got == etag {
+		t.Errorf("changed scrape: got the unchanged ETag %s", got)
+	}
+}
+
+func TestMetricsHandlerWithoutETag(t *testing.T) {
+	up, scrapes := 1.0, 0
+	handler := metricsHandler(prometheus.NewRegistry(), func(context.Context) prometheus.Collector {
+		return testChronyCollector{up: &up, scrapes: &scrapes}
+	}, false)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") != "" {
+		t.Errorf("got status %d and ETag %q, want 200 without an ETag", rec.Code, rec.Header().Get("ETag"))
+	}
+}
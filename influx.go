@@ -0,0 +1,105 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const influxMeasurement = "chrony"
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxKeyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// influxHandler serves the gathered metrics as InfluxDB line protocol when
+// requested with `?format=influx`, all other requests are passed to next.
+func influxHandler(g prometheus.Gatherer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") != "influx" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		mfs, err := g.Gather()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("error gathering metrics: %s", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		writeInfluxLines(w, mfs, time.Now())
+	})
+}
+
+// writeInfluxLines writes one line per sample, using the metric name without
+// the namespace as the field key and the labels as tags. Histograms and
+// summaries are written as their sum and count.
+func writeInfluxLines(w io.Writer, mfs []*dto.MetricFamily, ts time.Time) error {
+	bw := bufio.NewWriter(w)
+	for _, mf := range mfs {
+		field := strings.TrimPrefix(mf.GetName(), influxMeasurement+"_")
+		for _, m := range mf.GetMetric() {
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				writeInfluxLine(bw, field, m.GetLabel(), m.GetCounter().GetValue(), ts)
+			case dto.MetricType_GAUGE:
+				writeInfluxLine(bw, field, m.GetLabel(), m.GetGauge().GetValue(), ts)
+			case dto.MetricType_UNTYPED:
+				writeInfluxLine(bw, field, m.GetLabel(), m.GetUntyped().GetValue(), ts)
+			case dto.MetricType_HISTOGRAM:
+				writeInfluxLine(bw, field+"_sum", m.GetLabel(), m.GetHistogram().GetSampleSum(), ts)
+				writeInfluxLine(bw, field+"_count", m.GetLabel(), float64(m.GetHistogram().GetSampleCount()), ts)
+			case dto.MetricType_SUMMARY:
+				writeInfluxLine(bw, field+"_sum", m.GetLabel(), m.GetSummary().GetSampleSum(), ts)
+				writeInfluxLine(bw, field+"_count", m.GetLabel(), float64(m.GetSummary().GetSampleCount()), ts)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+func writeInfluxLine(w *bufio.Writer, field string, labels []*dto.LabelPair, value float64, ts time.Time) {
+	// Line protocol has no representation for NaN or infinite values.
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+	w.WriteString(influxMeasurementEscaper.Replace(influxMeasurement))
+	for _, l := range labels {
+		// Empty tag values are not allowed.
+		if l.GetValue() == "" {
+			continue
+		}
+		w.WriteByte(',')
+		w.WriteString(influxKeyEscaper.Replace(l.GetName()))
+		w.WriteByte('=')
+		w.WriteString(influxKeyEscaper.Replace(l.GetValue()))
+	}
+	w.WriteByte(' ')
+	w.WriteString(influxKeyEscaper.Replace(field))
+	w.WriteByte('=')
+	w.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	w.WriteByte(' ')
+	w.WriteString(strconv.FormatInt(ts.UnixNano(), 10))
+	w.WriteByte('\n')
+}
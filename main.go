@@ -14,9 +14,19 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
 
 	"github.com/superq/chrony_exporter/collector"
 
@@ -34,48 +44,396 @@ import (
 var (
 	conf   = collector.ChronyCollectorConfig{}
 	logger *slog.Logger
+
+	addressSetByUser bool
+	fdSetByUser      bool
 )
 
+// fileConn wraps an inherited file descriptor as the chrony connection. The
+// command protocol is datagram based, so the descriptor must be a connected
+// UDP or unix datagram socket.
+func fileConn(fd int) (net.Conn, error) {
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd))
+	if f == nil {
+		return nil, fmt.Errorf("invalid file descriptor %d", fd)
+	}
+	// FileConn duplicates the descriptor.
+	defer f.Close()
+	conn, err := net.FileConn(f)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := conn.(*net.TCPConn); ok {
+		conn.Close()
+		return nil, fmt.Errorf("file descriptor %d is a stream socket, expected a datagram socket", fd)
+	}
+	if conn.RemoteAddr() == nil {
+		conn.Close()
+		return nil, fmt.Errorf("file descriptor %d is not a connected socket", fd)
+	}
+	return conn, nil
+}
+
+// parseNetwork parses a CIDR, or a single IP address as a host network.
+func parseNetwork(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, network, err := net.ParseCIDR(s)
+		return network, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address")
+	}
+	bits := 8 * net.IPv6len
+	if ip.To4() != nil {
+		ip = ip.To4()
+		bits = 8 * net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// metricsHandler serves the metrics of gatherer together with the chrony
+// metrics, which are collected with the context of the scrape request so
+// that the DNS lookups of an abandoned scrape are cancelled. With etag, the
+// responses have an ETag of the chrony metrics.
+func metricsHandler(gatherer prometheus.Gatherer, chrony func(context.Context) prometheus.Collector, etag bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(chrony(r.Context()))
+		if !etag {
+			promhttp.HandlerFor(prometheus.Gatherers{gatherer, registry}, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+			return
+		}
+		g := &etagGatherer{Gatherer: registry}
+		etagHandler(promhttp.HandlerFor(prometheus.Gatherers{gatherer, g}, promhttp.HandlerOpts{}), g).ServeHTTP(w, r)
+	})
+}
+
 func main() {
 	kingpin.Flag(
 		"chrony.address",
-		"Address of the Chrony srever.",
-	).Default("[::1]:323").StringVar(&conf.Address)
+		"Address of the Chrony srever. A tcp:// address requires a bridge using the exporter-specific length prefix framing, chronyd has no TCP command socket.",
+	).Default("[::1]:323").IsSetByUser(&addressSetByUser).StringVar(&conf.Address)
+
+	chronyConfigFile := kingpin.Flag(
+		"chrony.config-file",
+		"Path to chrony.conf used to discover the command address when --chrony.address is not set.",
+	).Default("/etc/chrony/chrony.conf").String()
+
+	kingpin.Flag(
+		"chrony.ntpdata-address",
+		"Separate address of the Chrony server for the ntpdata requests of --collector.sources.with-ntpdata, such as unix:///run/chrony/chronyd.sock.",
+	).PlaceHolder("ADDRESS").StringVar(&conf.NTPDataAddress)
+
+	kingpin.Flag(
+		"chrony.network",
+		"Network used to connect to a UDP Chrony address, one of: [udp, udp4, udp6]",
+	).Default("udp").EnumVar(&conf.Network, "udp", "udp4", "udp6")
+
+	kingpin.Flag(
+		"chrony.netns",
+		"Name or path of a network namespace to connect to the Chrony server in, requires CAP_SYS_ADMIN. Linux only, the exporter exits with an error when it is set on other platforms.",
+	).PlaceHolder("NAME").StringVar(&conf.Netns)
+
+	kingpin.Flag(
+		"chrony.exec",
+		"Experimental: Command used to run chronyc, such as 'docker exec chrony chronyc'. When set, only tracking and sources are collected by parsing the chronyc CSV output.",
+	).PlaceHolder("COMMAND").StringVar(&conf.Exec)
+
+	chronyFD := kingpin.Flag(
+		"chrony.fd",
+		"Inherited file descriptor of a connected chrony command socket, used instead of --chrony.address.",
+	).PlaceHolder("FD").IsSetByUser(&fdSetByUser).Int()
 
 	kingpin.Flag(
 		"chrony.timeout",
 		"Timeout on requests to the Chrony srever.",
 	).Default("5s").DurationVar(&conf.Timeout)
 
+	kingpin.Flag(
+		"collector.minimal",
+		"Only check that chrony responds and export chrony_up, all other collectors are skipped",
+	).Default("false").BoolVar(&conf.Minimal)
+
+	kingpin.Flag(
+		"collector.soft-fail",
+		"Collector whose failures don't set chrony_up to 0, one of: [sources, sourcestats, tracking, serverstats, refclock]. Repeatable.",
+	).PlaceHolder("COLLECTOR").EnumsVar(&conf.SoftFailCollectors, "sources", "sourcestats", "tracking", "serverstats", "refclock")
+
+	requireEnabled := kingpin.Flag(
+		"collector.require-enabled",
+		"Exit at startup when no data collectors are enabled, instead of logging a warning",
+	).Default("false").Bool()
+
 	kingpin.Flag(
 		"collector.tracking",
 		"Collect tracking metrics",
 	).Default("true").BoolVar(&conf.CollectTracking)
 
+	kingpin.Flag(
+		"collector.tracking.samples",
+		"Number of tracking samples taken per scrape within --chrony.timeout to compute the offset jitter, 1 disables",
+	).Default("1").IntVar(&conf.TrackingSamples)
+
+	kingpin.Flag(
+		"collector.tracking.offset-baseline-window",
+		"Experimental: Window of the rolling mean tracking offset used for the offset deviation metric, 0 disables",
+	).Default("0s").DurationVar(&conf.TrackingOffsetBaselineWindow)
+
+	kingpin.Flag(
+		"collector.tracking.step-threshold",
+		"Minimum step of the system clock between scrapes counted in chrony_tracking_steps_detected_total with a unix socket address, 0 disables",
+	).Default("0s").DurationVar(&conf.TrackingStepThreshold)
+
+	kingpin.Flag(
+		"collector.logfile.path",
+		"Path to the chrony logdir, read tracking metrics from its tracking.log instead of the tracking command",
+	).PlaceHolder("DIR").StringVar(&conf.LogfilePath)
+
 	kingpin.Flag(
 		"collector.sources",
 		"Collect sources metrics",
 	).Default("false").BoolVar(&conf.CollectSources)
 
+	kingpin.Flag(
+		"collector.sources.stratum-label",
+		"Add a stratum label to the sources state info metric",
+	).Default("false").BoolVar(&conf.SourcesStratumLabel)
+
+	sourcesIncludeAddresses := kingpin.Flag(
+		"collector.sources.include-addresses",
+		"Only collect sources metrics for the given IP address or CIDR. Repeatable.",
+	).PlaceHolder("CIDR").Strings()
+
+	kingpin.Flag(
+		"collector.sources.skip-unknown-state",
+		"Skip sources in a state unknown to the exporter",
+	).Default("false").BoolVar(&conf.SourcesSkipUnknownState)
+
+	kingpin.Flag(
+		"collector.sources.aggregate-only",
+		"Only collect aggregate sources metrics, without per source series",
+	).Default("false").BoolVar(&conf.SourcesAggregateOnly)
+
+	kingpin.Flag(
+		"collector.sources.with-ntpdata",
+		"Collect ntpdata metrics for each NTP source, requires a unix socket --chrony.address or --chrony.ntpdata-address",
+	).Default("false").BoolVar(&conf.SourcesWithNTPData)
+
+	kingpin.Flag(
+		"collector.ntpdata.only-selected",
+		"Only collect ntpdata metrics for the source selected by tracking, requires --collector.tracking and --collector.sources.with-ntpdata",
+	).Default("false").BoolVar(&conf.NTPDataOnlySelected)
+
+	kingpin.Flag(
+		"collector.sources.selected-refid-label",
+		"Add the refid of the source selected by tracking as a selected_refid label to the sources metrics",
+	).Default("false").BoolVar(&conf.SourcesSelectedRefIDLabel)
+
+	kingpin.Flag(
+		"collector.sources.use-configured-names",
+		"Use the source names configured in chrony for the sources source_name label, falling back to DNS lookups",
+	).Default("false").BoolVar(&conf.SourcesUseConfiguredNames)
+
+	kingpin.Flag(
+		"collector.sources.reachability-bits",
+		"Collect each of the 8 bits of the sources reachability register as a separate series",
+	).Default("false").BoolVar(&conf.SourcesReachabilityBits)
+
+	kingpin.Flag(
+		"collector.sources.batch",
+		"Pipeline the sourcedata requests instead of waiting for each reply",
+	).Default("false").BoolVar(&conf.SourcesBatch)
+
+	kingpin.Flag(
+		"collector.sources.workers",
+		"Number of connections the sourcedata requests are spread over, each with its own receiving socket",
+	).Default("1").IntVar(&conf.SourcesWorkers)
+
+	kingpin.Flag(
+		"collector.sources.state-codes",
+		"Collect the sources state as a numeric code in chrony_sources_state, in addition to the state info metric",
+	).Default("false").BoolVar(&conf.SourcesStateCodes)
+
+	kingpin.Flag(
+		"collector.sources.last-sample-timestamp",
+		"Collect the sources last sample time as a unix timestamp, in addition to the sample age",
+	).Default("false").BoolVar(&conf.SourcesLastSampleTimestamp)
+
+	kingpin.Flag(
+		"collector.sources.offset-window",
+		"Sliding window of the chrony_sources_offset_seconds summary of the last sample offsets, 0 disables",
+	).Default("0s").DurationVar(&conf.SourcesOffsetWindow)
+
+	kingpin.Flag(
+		"collector.sources.offset-quantile",
+		"Quantile of the chrony_sources_offset_seconds summary. Repeatable.",
+	).Default("0.5", "0.9", "0.99").Float64ListVar(&conf.SourcesOffsetQuantiles)
+
+	kingpin.Flag(
+		"collector.sources.offset-spread-all",
+		"Compute chrony_sources_offset_spread_seconds over all sources, instead of only the selectable sources",
+	).Default("false").BoolVar(&conf.SourcesOffsetSpreadAll)
+
+	kingpin.Flag(
+		"collector.sources.stale-threshold",
+		"Last sample age after which a source is counted in chrony_sources_stale_count, 0 uses twice the polling interval of each source",
+	).Default("0s").DurationVar(&conf.SourcesStaleThreshold)
+
+	kingpin.Flag(
+		"collector.timestamps-milliseconds",
+		"Additionally emit tracking and sources timestamps as integer milliseconds",
+	).Default("false").BoolVar(&conf.TimestampsMilliseconds)
+
+	kingpin.Flag(
+		"collector.sourcestats",
+		"Collect sourcestats metrics",
+	).Default("false").BoolVar(&conf.CollectSourcestats)
+
 	kingpin.Flag(
 		"collector.serverstats",
 		"Collect serverstats metrics",
 	).Default("false").BoolVar(&conf.CollectServerstats)
 
+	kingpin.Flag(
+		"collector.refclock",
+		"Collect reference clock lock status metrics",
+	).Default("false").BoolVar(&conf.CollectRefclock)
+
+	kingpin.Flag(
+		"collector.external-ntp",
+		"External NTP server to query directly to cross-check the local clock offset. Repeatable.",
+	).PlaceHolder("SERVER").StringsVar(&conf.ExternalNTPServers)
+
+	collectProcess := kingpin.Flag(
+		"collector.process",
+		"Collect chronyd process metrics, requires access to --chrony.pid-file and the chronyd /proc entry (Linux only, ignored with a warning elsewhere)",
+	).Default("false").Bool()
+
+	pidFile := kingpin.Flag(
+		"chrony.pid-file",
+		"Path to the chronyd pid file, used by the process collector.",
+	).Default("/run/chrony/chronyd.pid").String()
+
 	kingpin.Flag(
 		"collector.chmod-socket",
 		"Chmod 0666 the receiving unix datagram socket",
 	).Default("false").BoolVar(&conf.ChmodSocket)
 
+	kingpin.Flag(
+		"collector.stale-socket-age",
+		"Remove receiving unix datagram sockets left by other exporter processes older than this at startup, 0 disables",
+	).Default("0s").DurationVar(&conf.StaleSocketAge)
+
 	kingpin.Flag(
 		"collector.dns-lookups", "do reverse DNS lookups",
 	).Default("true").BoolVar(&conf.DNSLookups)
 
+	kingpin.Flag(
+		"collector.dns-canonical-only",
+		"Use only the shortest reverse DNS name of an address, instead of joining all names",
+	).Default("false").BoolVar(&conf.DNSCanonicalOnly)
+
+	kingpin.Flag(
+		"collector.sources.name-label-max-length",
+		"Maximum length of reverse DNS names joined into a name label, 0 for no limit",
+	).Default("0").IntVar(&conf.NameMaxLength)
+
+	nameMap := kingpin.Flag(
+		"collector.name-map",
+		"Static IP to name mapping, takes precedence over reverse DNS lookups (i.e. 192.0.2.1=ntp1). Repeatable.",
+	).PlaceHolder("IP=NAME").Strings()
+
+	kingpin.Flag(
+		"collector.share-scrapes",
+		"Share a single in-flight collection between concurrent scrapes, instead of querying chrony for each scrape",
+	).Default("false").BoolVar(&conf.ShareScrapes)
+
+	kingpin.Flag(
+		"log.trace-metrics",
+		"Log the name, labels and value of every emitted metric at debug level",
+	).Default("false").BoolVar(&conf.TraceMetrics)
+
+	kingpin.Flag(
+		"metric.round-digits",
+		"Round gauge values to this number of significant digits, 0 keeps the full precision",
+	).Default("0").IntVar(&conf.RoundDigits)
+
+	hostLabel := kingpin.Flag(
+		"metric.chrony-host-label",
+		"Add a chrony_host label with the hostname to all chrony metrics",
+	).Default("false").Bool()
+
+	kingpin.Flag(
+		"metric.chrony-host",
+		"Value of the chrony_host label, instead of the hostname. Implies --metric.chrony-host-label",
+	).PlaceHolder("NAME").StringVar(&conf.HostLabel)
+
+	targetsFile := kingpin.Flag(
+		"config.targets-file",
+		"Path to a JSON file of chrony targets with per target overrides, collected at /probe?target=NAME.",
+	).PlaceHolder("FILE").String()
+
+	remoteWriteURL := kingpin.Flag(
+		"remote-write.url",
+		"Prometheus remote write URL to periodically push the chrony metrics to, in addition to serving them.",
+	).PlaceHolder("URL").String()
+
+	remoteWriteInterval := kingpin.Flag(
+		"remote-write.interval",
+		"Interval between remote writes.",
+	).Default("1m").Duration()
+
+	remoteWriteJob := kingpin.Flag(
+		"remote-write.job",
+		"Value of the job label added to remote written series, the instance label is the hostname.",
+	).Default("chrony").String()
+
+	remoteWriteHeaders := kingpin.Flag(
+		"remote-write.header",
+		"HTTP header added to remote write requests, such as 'Authorization: Bearer TOKEN'. Repeatable.",
+	).PlaceHolder("NAME: VALUE").Strings()
+
+	check := kingpin.Flag(
+		"chrony.check",
+		"Collect once, print the results and exit non-zero if chrony is down, without starting the web server.",
+	).Default("false").Bool()
+
+	dump := kingpin.Flag(
+		"dump",
+		"Collect once, write the metrics to stdout in the Prometheus text format and exit, without starting the web server.",
+	).Default("false").Bool()
+
+	pushGatewayURL := kingpin.Flag(
+		"push.gateway-url",
+		"Collect once, push the metrics to this Pushgateway URL and exit non-zero if chrony is down or the push failed, without starting the web server.",
+	).PlaceHolder("URL").String()
+
+	pushJob := kingpin.Flag(
+		"push.job",
+		"Job name of the pushed metrics, grouped by the hostname as instance.",
+	).Default("chrony").String()
+
 	metricsPath := kingpin.Flag(
 		"web.telemetry-path",
 		"Path under which to expose metrics.",
 	).Default("/metrics").String()
 
+	enableETag := kingpin.Flag(
+		"web.enable-etag",
+		"Experimental: Add an ETag derived from the chrony metrics to metrics responses and reply 304 Not Modified when they are unchanged.",
+	).Default("false").Bool()
+
+	enableLifecycle := kingpin.Flag(
+		"web.enable-lifecycle",
+		"Enable the /-/reload endpoint to re-read --chrony.config-file and --config.targets-file.",
+	).Default("false").Bool()
+
+	enableAPI := kingpin.Flag(
+		"web.enable-api",
+		"Enable the read-only JSON API at /api/v1/tracking and /api/v1/sources.",
+	).Default("false").Bool()
+
 	toolkitFlags := kingpinflag.AddFlags(kingpin.CommandLine, ":9123")
 
 	promslogConfig := &promslog.Config{}
@@ -85,14 +443,231 @@ func main() {
 	kingpin.Version(version.Print("chrony_exporter"))
 	kingpin.Parse()
 
+	conf.NameMap = make(map[string]string, len(*nameMap))
+	for _, m := range *nameMap {
+		address, name, ok := strings.Cut(m, "=")
+		if !ok || net.ParseIP(address) == nil {
+			kingpin.Fatalf("invalid --collector.name-map %q, expected IP=NAME", m)
+		}
+		conf.NameMap[address] = name
+	}
+
+	for _, a := range *sourcesIncludeAddresses {
+		network, err := parseNetwork(a)
+		if err != nil {
+			kingpin.Fatalf("invalid --collector.sources.include-addresses %q: %s", a, err)
+		}
+		conf.SourcesIncludeAddresses = append(conf.SourcesIncludeAddresses, network)
+	}
+
+	if *check {
+		// Show the collector errors that are normally only logged at debug level.
+		_ = promslogConfig.Level.Set("debug")
+	}
 	logger = promslog.New(promslogConfig)
 	logger.Info("Starting chrony_exporter", "version", version.Info())
+
+	// Only chrony_up is exported without a data collector, which is usually a
+	// misconfiguration unless minimal mode is explicitly enabled.
+	if !conf.Minimal && !conf.CollectTracking && !conf.CollectSources && !conf.CollectSourcestats && !conf.CollectServerstats && !conf.CollectRefclock && len(conf.ExternalNTPServers) == 0 && !*collectProcess {
+		if *requireEnabled {
+			logger.Error("No data collectors are enabled")
+			os.Exit(1)
+		}
+		logger.Warn("No data collectors are enabled, only chrony_up will be exported")
+	}
+
+	if *hostLabel && conf.HostLabel == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			logger.Error("Unable to get hostname for the chrony_host label", "err", err)
+			os.Exit(1)
+		}
+		conf.HostLabel = hostname
+	}
+
+	if conf.Netns != "" && runtime.GOOS != "linux" {
+		logger.Error("--chrony.netns is only supported on Linux", "netns", conf.Netns)
+		os.Exit(1)
+	}
+
+	if fdSetByUser {
+		conn, err := fileConn(*chronyFD)
+		if err != nil {
+			logger.Error("Unable to use the inherited chrony connection", "fd", *chronyFD, "err", err)
+			os.Exit(1)
+		}
+		conf.Conn = conn
+		conf.Address = conn.RemoteAddr().String()
+		// The address is only informational, don't replace it on reload.
+		addressSetByUser = true
+		logger.Info("Using inherited chrony connection", "fd", *chronyFD, "address", conf.Address)
+	}
+
+	if !addressSetByUser && *chronyConfigFile != "" {
+		chronyConf, err := readChronyConfig(*chronyConfigFile)
+		switch {
+		case err == nil:
+			conf.Address = chronyConf.address()
+			logger.Info("Discovered chrony address from config file", "file", *chronyConfigFile, "address", conf.Address)
+		case errors.Is(err, fs.ErrNotExist):
+			logger.Debug("Chrony config file not found, using default address", "file", *chronyConfigFile)
+		default:
+			logger.Warn("Unable to read chrony config file, using default address", "file", *chronyConfigFile, "err", err)
+		}
+	}
+
 	prometheus.MustRegister(versioncollector.NewCollector("chrony_exporter"))
 
+	startTime := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "chrony",
+		Subsystem: "exporter",
+		Name:      "start_time_seconds",
+		Help:      "Start time of the exporter since unix epoch in seconds.",
+	})
+	startTime.SetToCurrentTime()
+	collectorEnabled := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "chrony",
+		Subsystem: "exporter",
+		Name:      "collector_enabled",
+		Help:      "Whether a collector is enabled in the exporter configuration.",
+	}, []string{"collector"})
+	for name, enabled := range map[string]bool{
+		"tracking":    conf.CollectTracking,
+		"sources":     conf.CollectSources,
+		"sourcestats": conf.CollectSourcestats,
+		"serverstats": conf.CollectServerstats,
+		"refclock":    conf.CollectRefclock,
+		"ntpdata":     conf.CollectSources && conf.SourcesWithNTPData,
+	} {
+		if enabled && !conf.Minimal {
+			collectorEnabled.WithLabelValues(name).Set(1)
+		} else {
+			collectorEnabled.WithLabelValues(name).Set(0)
+		}
+	}
+	prometheus.MustRegister(
+		startTime,
+		collectorEnabled,
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "chrony",
+			Subsystem: "exporter",
+			Name:      "scrapes_total",
+			Help:      "Total number of scrapes of the chrony server.",
+		}, func() float64 { return float64(collector.Scrapes()) }),
+	)
+
 	exporter := collector.NewExporter(conf, logger)
-	prometheus.MustRegister(exporter)
+	exporter.RemoveStaleSockets()
+
+	if *check {
+		os.Exit(runCheck(os.Stdout, exporter, conf.Address))
+	}
+	if *dump {
+		os.Exit(runDump(os.Stdout, exporter))
+	}
+	if *pushGatewayURL != "" {
+		os.Exit(runPush(os.Stderr, exporter, *pushGatewayURL, *pushJob))
+	}
+
+	reloadable := &reloadableCollector{collector: exporter}
+
+	targets := &targetExporters{}
+	if *targetsFile != "" {
+		if err := targets.load(*targetsFile, conf, logger); err != nil {
+			logger.Error("Unable to load targets file", "file", *targetsFile, "err", err)
+			os.Exit(1)
+		}
+		logger.Info("Loaded targets file", "file", *targetsFile, "targets", targets.len())
+	}
+
+	// Reload re-reads the chrony config file and the targets file and
+	// replaces the exporters. A file that can't be read or is invalid leaves
+	// its running exporters unchanged.
+	var reloadMtx sync.Mutex
+	reload := func() error {
+		reloadMtx.Lock()
+		defer reloadMtx.Unlock()
+		var errs []error
+		if !addressSetByUser && *chronyConfigFile != "" {
+			if chronyConf, err := readChronyConfig(*chronyConfigFile); err != nil {
+				errs = append(errs, fmt.Errorf("chrony config file: %w", err))
+			} else {
+				conf.Address = chronyConf.address()
+				reloadable.set(collector.NewExporter(conf, logger))
+				logger.Info("Reloaded chrony config file", "file", *chronyConfigFile, "address", conf.Address)
+			}
+		}
+		if *targetsFile != "" {
+			if err := targets.load(*targetsFile, conf, logger); err != nil {
+				errs = append(errs, fmt.Errorf("targets file: %w", err))
+			} else {
+				logger.Info("Reloaded targets file", "file", *targetsFile, "targets", targets.len())
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := reload(); err != nil {
+				logger.Error("Unable to reload config", "err", err)
+			}
+		}
+	}()
+
+	if *collectProcess {
+		if c := newProcessCollector(*pidFile, logger); c != nil {
+			prometheus.MustRegister(c)
+		}
+	}
 
-	http.Handle(*metricsPath, promhttp.Handler())
+	// The InfluxDB output and remote write only include the chrony metrics.
+	influxRegistry := prometheus.NewRegistry()
+	influxRegistry.MustRegister(reloadable)
+	if *remoteWriteURL != "" {
+		headers := make(http.Header, len(*remoteWriteHeaders))
+		for _, h := range *remoteWriteHeaders {
+			name, value, ok := strings.Cut(h, ":")
+			if !ok {
+				kingpin.Fatalf("invalid --remote-write.header %q, expected NAME: VALUE", h)
+			}
+			headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+		hostname, err := os.Hostname()
+		if err != nil {
+			logger.Error("Unable to get hostname for remote write", "err", err)
+			os.Exit(1)
+		}
+		rw := &remoteWriter{
+			url:      *remoteWriteURL,
+			interval: *remoteWriteInterval,
+			headers:  headers,
+			labels:   []remoteWriteLabel{{"instance", hostname}, {"job", *remoteWriteJob}},
+			gatherer: influxRegistry,
+			client:   &http.Client{Timeout: *remoteWriteInterval},
+			logger:   logger,
+		}
+		go rw.run(context.Background())
+		logger.Info("Remote writing metrics", "url", *remoteWriteURL, "interval", *remoteWriteInterval)
+	}
+
+	chronyHandler := metricsHandler(prometheus.DefaultGatherer, reloadable.withContext, *enableETag)
+	handler := influxHandler(influxRegistry, promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, chronyHandler))
+	http.Handle(*metricsPath, handler)
+	if *enableLifecycle {
+		http.Handle("/-/reload", reloadHandler(reload))
+	}
+	if *enableAPI {
+		current := func() collector.Exporter { return reloadable.get().(collector.Exporter) }
+		http.Handle("/api/v1/tracking", apiHandler(current, func(e collector.Exporter) (any, error) { return e.Tracking() }))
+		http.Handle("/api/v1/sources", apiHandler(current, func(e collector.Exporter) (any, error) { return e.Sources() }))
+	}
+	if *targetsFile != "" {
+		http.Handle("/probe", probeHandler(targets))
+	}
 	if *metricsPath != "/" && *metricsPath != "" {
 		landingConfig := web.LandingConfig{
 			Name:        "Chrony Exporter",
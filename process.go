@@ -0,0 +1,46 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log/slog"
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// newProcessCollector returns a collector of the chronyd process metrics,
+// or nil on platforms without /proc. The metrics are absent while the pid
+// file can't be read, so this is logged.
+func newProcessCollector(pidFile string, logger *slog.Logger) prometheus.Collector {
+	if runtime.GOOS != "linux" {
+		logger.Warn("The process collector is only supported on Linux, the chronyd process metrics are disabled")
+		return nil
+	}
+	readPid := prometheus.NewPidFileFn(pidFile)
+	if _, err := readPid(); err != nil {
+		logger.Warn("Unable to read the chronyd pid file, the chronyd process metrics are absent until it can be read", "file", pidFile, "err", err)
+	}
+	return collectors.NewProcessCollector(collectors.ProcessCollectorOpts{
+		PidFn: func() (int, error) {
+			pid, err := readPid()
+			if err != nil {
+				logger.Debug("Unable to read the chronyd pid file", "file", pidFile, "err", err)
+			}
+			return pid, err
+		},
+		Namespace: "chrony",
+	})
+}
@@ -0,0 +1,67 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestProcessCollector(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the process collector requires /proc")
+	}
+	pidFile := filepath.Join(t.TempDir(), "chronyd.pid")
+	if err := os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c := newProcessCollector(pidFile, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if c == nil {
+		t.Fatal("newProcessCollector: got nil on Linux")
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if mf.GetName() == "chrony_process_cpu_seconds_total" {
+			return
+		}
+	}
+	t.Error("chrony_process_cpu_seconds_total: missing")
+}
+
+func TestProcessCollectorMissingPidFile(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the process collector requires /proc")
+	}
+	var log strings.Builder
+	c := newProcessCollector(filepath.Join(t.TempDir(), "missing.pid"), slog.New(slog.NewTextHandler(&log, nil)))
+	if c == nil {
+		t.Fatal("newProcessCollector: got nil on Linux")
+	}
+	if !strings.Contains(log.String(), "level=WARN") {
+		t.Errorf("missing pid file: got log %q, want a warning", log.String())
+	}
+}
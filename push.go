@@ -0,0 +1,67 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// runPush collects from the exporter once and pushes the metrics to the
+// Pushgateway, grouped by job and the hostname as instance. It returns the
+// process exit code, 0 when chrony is up and the push succeeded.
+func runPush(w io.Writer, exporter prometheus.Collector, url, job string) int {
+	hostname, err := os.Hostname()
+	if err != nil {
+		fmt.Fprintf(w, "unable to get hostname: %s\n", err)
+		return 1
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	families, err := registry.Gather()
+	if err != nil {
+		fmt.Fprintf(w, "unable to gather metrics: %s\n", err)
+		return 1
+	}
+
+	// The families are gathered once, so the pushed chrony_up matches the
+	// exit code.
+	gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return families, nil })
+	if err := push.New(url, job).Gatherer(gatherer).Grouping("instance", hostname).Push(); err != nil {
+		fmt.Fprintf(w, "unable to push metrics to %s: %s\n", url, err)
+		return 1
+	}
+
+	if !chronyUp(families) {
+		fmt.Fprintln(w, "chrony is down, pushed chrony_up 0")
+		return 1
+	}
+	return 0
+}
+
+// chronyUp returns the chrony_up status.
+func chronyUp(families []*dto.MetricFamily) bool {
+	for _, mf := range families {
+		if mf.GetName() == "chrony_up" && len(mf.GetMetric()) > 0 {
+			return mf.GetMetric()[0].GetGauge().GetValue() == 1
+		}
+	}
+	return false
+}
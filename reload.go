@@ -0,0 +1,77 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/superq/chrony_exporter/collector"
+)
+
+// reloadableCollector delegates to a collector that can be replaced at
+// runtime, as the registry can't unregister unchecked collectors.
+type reloadableCollector struct {
+	mtx       sync.RWMutex
+	collector prometheus.Collector
+}
+
+// Describe implements prometheus.Collector.
+func (r *reloadableCollector) Describe(ch chan<- *prometheus.Desc) {
+}
+
+// Collect implements prometheus.Collector.
+func (r *reloadableCollector) Collect(ch chan<- prometheus.Metric) {
+	r.mtx.RLock()
+	c := r.collector
+	r.mtx.RUnlock()
+	c.Collect(ch)
+}
+
+func (r *reloadableCollector) get() prometheus.Collector {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.collector
+}
+
+// withContext returns the current exporter collecting with ctx.
+func (r *reloadableCollector) withContext(ctx context.Context) prometheus.Collector {
+	return r.get().(collector.Exporter).WithContext(ctx)
+}
+
+func (r *reloadableCollector) set(c prometheus.Collector) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.collector = c
+}
+
+// reloadHandler triggers a reload on POST or PUT, returning the error in the
+// response body when the reload fails.
+func reloadHandler(reload func() error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut:
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			fmt.Fprintf(w, "This endpoint requires a POST or PUT request.\n")
+			return
+		}
+		if err := reload(); err != nil {
+			http.Error(w, fmt.Sprintf("failed to reload config: %s", err), http.StatusInternalServerError)
+		}
+	})
+}
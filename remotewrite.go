@@ -0,0 +1,222 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// remoteWriteMinBackoff is the first delay before retrying a failed
+	// remote write, doubled up to the write interval.
+	remoteWriteMinBackoff = time.Second
+)
+
+// remoteWriteLabel is a remote write label pair.
+type remoteWriteLabel struct {
+	name, value string
+}
+
+// remoteWriteSeries is a remote write time series with a single sample.
+type remoteWriteSeries struct {
+	labels []remoteWriteLabel
+	value  float64
+}
+
+// remoteWriter periodically gathers the metrics and pushes them with the
+// Prometheus remote write 1.0 protocol.
+type remoteWriter struct {
+	url      string
+	interval time.Duration
+	headers  http.Header
+	labels   []remoteWriteLabel
+	gatherer prometheus.Gatherer
+	client   *http.Client
+	logger   *slog.Logger
+}
+
+// run writes the metrics every interval until the context is cancelled.
+func (rw *remoteWriter) run(ctx context.Context) {
+	ticker := time.NewTicker(rw.interval)
+	defer ticker.Stop()
+	for {
+		rw.writeWithBackoff(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// writeWithBackoff gathers and writes the metrics once, retrying
+// recoverable errors with an exponential backoff within the interval.
+func (rw *remoteWriter) writeWithBackoff(ctx context.Context) {
+	mfs, err := rw.gatherer.Gather()
+	if err != nil {
+		rw.logger.Error("Unable to gather metrics for remote write", "err", err)
+		return
+	}
+	body := encodeWriteRequest(remoteWriteTimeseries(mfs, rw.labels, time.Now()))
+
+	deadline := time.Now().Add(rw.interval)
+	backoff := remoteWriteMinBackoff
+	for {
+		recoverable, err := rw.send(ctx, body)
+		if err == nil {
+			return
+		}
+		if !recoverable || time.Now().Add(backoff).After(deadline) {
+			rw.logger.Error("Remote write failed", "url", rw.url, "err", err)
+			return
+		}
+		rw.logger.Warn("Remote write failed, retrying", "url", rw.url, "backoff", backoff, "err", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// send posts a snappy compressed write request. Network errors, 429 and 5xx
+// responses are recoverable.
+func (rw *remoteWriter) send(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rw.url, bytes.NewReader(s2.EncodeSnappy(nil, body)))
+	if err != nil {
+		return false, err
+	}
+	for name, values := range rw.headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := rw.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+	err = fmt.Errorf("server returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5, err
+}
+
+// remoteWriteTimeseries converts the metric families to time series, with
+// the classic _bucket, _sum and _count series for histograms and summaries.
+func remoteWriteTimeseries(mfs []*dto.MetricFamily, extra []remoteWriteLabel, ts time.Time) ([]remoteWriteSeries, int64) {
+	var series []remoteWriteSeries
+	add := func(name string, labels []*dto.LabelPair, value float64, extraLabels ...remoteWriteLabel) {
+		ls := make([]remoteWriteLabel, 0, len(labels)+len(extra)+len(extraLabels)+1)
+		ls = append(ls, remoteWriteLabel{"__name__", name})
+		for _, l := range labels {
+			if l.GetValue() != "" {
+				ls = append(ls, remoteWriteLabel{l.GetName(), l.GetValue()})
+			}
+		}
+		ls = append(ls, extraLabels...)
+		ls = append(ls, extra...)
+		// Remote write requires the labels sorted by name.
+		sort.Slice(ls, func(i, j int) bool { return ls[i].name < ls[j].name })
+		series = append(series, remoteWriteSeries{labels: ls, value: value})
+	}
+	for _, mf := range mfs {
+		name := mf.GetName()
+		for _, m := range mf.GetMetric() {
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m.GetLabel(), m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, m.GetLabel(), m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add(name, m.GetLabel(), m.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, b := range h.GetBucket() {
+					add(name+"_bucket", m.GetLabel(), float64(b.GetCumulativeCount()), remoteWriteLabel{"le", formatFloat(b.GetUpperBound())})
+				}
+				add(name+"_bucket", m.GetLabel(), float64(h.GetSampleCount()), remoteWriteLabel{"le", "+Inf"})
+				add(name+"_sum", m.GetLabel(), h.GetSampleSum())
+				add(name+"_count", m.GetLabel(), float64(h.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add(name, m.GetLabel(), q.GetValue(), remoteWriteLabel{"quantile", formatFloat(q.GetQuantile())})
+				}
+				add(name+"_sum", m.GetLabel(), s.GetSampleSum())
+				add(name+"_count", m.GetLabel(), float64(s.GetSampleCount()))
+			}
+		}
+	}
+	return series, ts.UnixMilli()
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// encodeWriteRequest encodes a prometheus.WriteRequest protobuf message:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label { string name = 1; string value = 2; }
+//	Sample { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series []remoteWriteSeries, timestamp int64) []byte {
+	var req []byte
+	for _, s := range series {
+		var ts []byte
+		for _, l := range s.labels {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, l.name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, l.value)
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, label)
+		}
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(timestamp))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+	return req
+}
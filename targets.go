@@ -0,0 +1,177 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/superq/chrony_exporter/collector"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// targetCollectors are the collectors that can be enabled per target.
+var targetCollectors = []string{"tracking", "sources", "sourcestats", "serverstats", "refclock", "ntpdata"}
+
+// targetsConfig is the JSON targets file.
+type targetsConfig struct {
+	Targets []targetConfig `json:"targets"`
+}
+
+// targetConfig overrides the command line configuration for a single
+// target. Unset fields keep the command line value.
+type targetConfig struct {
+	Name        string   `json:"name"`
+	Address     string   `json:"address"`
+	Timeout     string   `json:"timeout,omitempty"`
+	DNSLookups  *bool    `json:"dns_lookups,omitempty"`
+	ChmodSocket *bool    `json:"chmod_socket,omitempty"`
+	Collectors  []string `json:"collectors,omitempty"`
+}
+
+// readTargetsConfig parses the JSON targets file at the given path.
+func readTargetsConfig(path string) ([]targetConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var conf targetsConfig
+	if err := json.Unmarshal(b, &conf); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(conf.Targets))
+	for _, t := range conf.Targets {
+		if t.Name == "" || t.Address == "" {
+			return nil, fmt.Errorf("target requires a name and an address")
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("duplicate target %q", t.Name)
+		}
+		names[t.Name] = true
+	}
+	return conf.Targets, nil
+}
+
+// collectorConfig applies the target overrides to the base configuration.
+func (t targetConfig) collectorConfig(base collector.ChronyCollectorConfig) (collector.ChronyCollectorConfig, error) {
+	conf := base
+	conf.Address = t.Address
+	conf.Conn = nil
+	if t.Timeout != "" {
+		timeout, err := time.ParseDuration(t.Timeout)
+		if err != nil {
+			return conf, fmt.Errorf("invalid timeout %q: %w", t.Timeout, err)
+		}
+		conf.Timeout = timeout
+	}
+	if t.DNSLookups != nil {
+		conf.DNSLookups = *t.DNSLookups
+	}
+	if t.ChmodSocket != nil {
+		conf.ChmodSocket = *t.ChmodSocket
+	}
+	if t.Collectors != nil {
+		for _, c := range t.Collectors {
+			if !slices.Contains(targetCollectors, c) {
+				return conf, fmt.Errorf("unknown collector %q, one of: %s", c, strings.Join(targetCollectors, ", "))
+			}
+		}
+		conf.CollectTracking = slices.Contains(t.Collectors, "tracking")
+		conf.CollectSources = slices.Contains(t.Collectors, "sources") || slices.Contains(t.Collectors, "ntpdata")
+		conf.CollectSourcestats = slices.Contains(t.Collectors, "sourcestats")
+		conf.CollectServerstats = slices.Contains(t.Collectors, "serverstats")
+		conf.CollectRefclock = slices.Contains(t.Collectors, "refclock")
+		conf.SourcesWithNTPData = slices.Contains(t.Collectors, "ntpdata")
+	}
+	return conf, nil
+}
+
+// newTargetExporters builds an exporter for each target. Targets that enable
+// ntpdata without a unix socket are logged, as chrony only allows it over the
+// unix socket.
+func newTargetExporters(targets []targetConfig, base collector.ChronyCollectorConfig, logger *slog.Logger) (map[string]collector.Exporter, error) {
+	exporters := make(map[string]collector.Exporter, len(targets))
+	for _, t := range targets {
+		conf, err := t.collectorConfig(base)
+		if err != nil {
+			return nil, fmt.Errorf("target %q: %w", t.Name, err)
+		}
+		if conf.SourcesWithNTPData && !strings.HasPrefix(conf.Address, "unix://") && !strings.HasPrefix(conf.NTPDataAddress, "unix://") {
+			logger.Warn("Target enables ntpdata without a unix socket address, the ntpdata metrics will be absent", "target", t.Name, "address", conf.Address)
+		}
+		exporters[t.Name] = collector.NewExporter(conf, logger.With("target", t.Name))
+	}
+	return exporters, nil
+}
+
+// targetExporters holds the exporters of the targets file, replaced as a
+// whole on reload.
+type targetExporters struct {
+	exporters atomic.Pointer[map[string]collector.Exporter]
+}
+
+// load reads and validates the targets file and replaces the exporters. A
+// file that can't be read or is invalid leaves the exporters unchanged.
+func (t *targetExporters) load(path string, base collector.ChronyCollectorConfig, logger *slog.Logger) error {
+	targets, err := readTargetsConfig(path)
+	if err != nil {
+		return err
+	}
+	exporters, err := newTargetExporters(targets, base, logger)
+	if err != nil {
+		return err
+	}
+	t.exporters.Store(&exporters)
+	return nil
+}
+
+func (t *targetExporters) get(name string) (collector.Exporter, bool) {
+	exporters := t.exporters.Load()
+	if exporters == nil {
+		return collector.Exporter{}, false
+	}
+	exporter, ok := (*exporters)[name]
+	return exporter, ok
+}
+
+func (t *targetExporters) len() int {
+	if exporters := t.exporters.Load(); exporters != nil {
+		return len(*exporters)
+	}
+	return 0
+}
+
+// probeHandler collects the target given by the `target` query parameter.
+func probeHandler(targets *targetExporters) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("target")
+		exporter, ok := targets.get(name)
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown target %q", name), http.StatusNotFound)
+			return
+		}
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(exporter.WithContext(r.Context()))
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+}
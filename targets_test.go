@@ -0,0 +1,81 @@
+// Copyright 2026 Ben Kochie
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/superq/chrony_exporter/collector"
+)
+
+func TestTargetExportersReload(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	path := filepath.Join(t.TempDir(), "targets.json")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	targets := &targetExporters{}
+	handler := probeHandler(targets)
+	probe := func(name string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/probe?target="+name, nil))
+		return rec.Code
+	}
+
+	write(`{"targets": [{"name": "a", "address": "127.0.0.1:1"}]}`)
+	if err := targets.load(path, collector.ChronyCollectorConfig{}, logger); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := targets.get("a"); !ok {
+		t.Fatal("target a: missing after load")
+	}
+
+	for _, invalid := range []string{
+		`{"targets": [`,
+		`{"targets": [{"name": "b"}]}`,
+		`{"targets": [{"name": "b", "address": "127.0.0.1:1", "collectors": ["unknown"]}]}`,
+	} {
+		write(invalid)
+		if err := targets.load(path, collector.ChronyCollectorConfig{}, logger); err == nil {
+			t.Errorf("load(%s): got no error", invalid)
+		}
+		if _, ok := targets.get("a"); !ok {
+			t.Errorf("load(%s): target a removed, want the old targets kept", invalid)
+		}
+	}
+
+	write(`{"targets": [{"name": "b", "address": "127.0.0.1:1"}]}`)
+	if err := targets.load(path, collector.ChronyCollectorConfig{}, logger); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := targets.get("a"); ok {
+		t.Error("target a: still present after reload")
+	}
+	if _, ok := targets.get("b"); !ok {
+		t.Error("target b: missing after reload")
+	}
+	if code := probe("a"); code != http.StatusNotFound {
+		t.Errorf("probe of removed target: got status %d, want 404", code)
+	}
+}